@@ -1,13 +1,22 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// Значение JWT_SECRET по умолчанию годится только для разработки.
+const defaultJWTSecret = "your_jwt_secret"
+
 type Config struct {
+	// development или production.
+	AppEnv     string
 	ServerPort string
 	JWTSecret  string
 	DBHost     string
@@ -15,6 +24,49 @@ type Config struct {
 	DBPassword string
 	DBName     string
 	DBPort     string
+
+	// Правки одного пользователя, сделанные в пределах этого окна,
+	// попадают в одну версию документа. 0 отключает объединение.
+	VersionCoalesceWindow time.Duration
+
+	// Как часто сессия совместного редактирования сохраняет документ.
+	CollabPersistInterval time.Duration
+
+	// Как часто удаляются истёкшие права доступа и за сколько до истечения
+	// участников предупреждают об этом.
+	ShareSweepInterval time.Duration
+	ShareExpiryWarning time.Duration
+
+	// Срок жизни access-токена JWT и непрозрачного refresh-токена.
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// Закрытый ключ RS256 или EdDSA для подписи JWT. Если не задан,
+	// токены подписываются HS256 с JWTSecret.
+	JWTSigningKeyFile string
+	// Ключи предыдущих поколений принимаются ещё JWTKeyRotationGrace
+	// после JWTKeyRotatedAt, чтобы уже выданные токены не стали недействительными.
+	JWTPreviousKeyFiles []string
+	JWTKeyRotatedAt     time.Time
+	JWTKeyRotationGrace time.Duration
+
+	// Адрес клиента, на который ведут ссылки из писем.
+	AppBaseURL string
+	// Страницы, с которых браузер может открыть WebSocket. Запросы с того же
+	// хоста и без заголовка Origin (не из браузера) разрешены всегда.
+	AllowedOrigins []string
+	// smtp, file или log. file сохраняет письма в MailDir, log выводит их в лог.
+	MailDriver   string
+	MailFrom     string
+	MailDir      string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+}
+
+func (c *Config) IsProduction() bool {
+	return c.AppEnv == "production"
 }
 
 func LoadConfig() (*Config, error) {
@@ -23,15 +75,138 @@ func LoadConfig() (*Config, error) {
 		log.Println("Error loading .env file")
 	}
 
-	return &Config{
+	versionCoalesceWindow, err := getDurationEnv("VERSION_COALESCE_WINDOW", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	collabPersistInterval, err := getDurationEnv("COLLAB_PERSIST_INTERVAL", 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if collabPersistInterval <= 0 {
+		return nil, fmt.Errorf("COLLAB_PERSIST_INTERVAL must be positive")
+	}
+
+	shareSweepInterval, err := getDurationEnv("SHARE_SWEEP_INTERVAL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if shareSweepInterval <= 0 {
+		return nil, fmt.Errorf("SHARE_SWEEP_INTERVAL must be positive")
+	}
+
+	shareExpiryWarning, err := getDurationEnv("SHARE_EXPIRY_WARNING", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	accessTokenTTL, err := getDurationEnv("ACCESS_TOKEN_TTL", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	if accessTokenTTL <= 0 {
+		return nil, fmt.Errorf("ACCESS_TOKEN_TTL must be positive")
+	}
+
+	refreshTokenTTL, err := getDurationEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	if refreshTokenTTL <= accessTokenTTL {
+		return nil, fmt.Errorf("REFRESH_TOKEN_TTL must be longer than ACCESS_TOKEN_TTL")
+	}
+
+	jwtKeyRotationGrace, err := getDurationEnv("JWT_KEY_ROTATION_GRACE", accessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwtPreviousKeyFiles []string
+	for _, path := range strings.Split(os.Getenv("JWT_PREVIOUS_KEY_FILES"), ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			jwtPreviousKeyFiles = append(jwtPreviousKeyFiles, path)
+		}
+	}
+
+	// Дата ротации обязательна: если отсчитывать от запуска, каждый
+	// перезапуск продлевал бы срок действия старых ключей.
+	var jwtKeyRotatedAt time.Time
+	if value := os.Getenv("JWT_KEY_ROTATED_AT"); value != "" {
+		if jwtKeyRotatedAt, err = time.Parse(time.RFC3339, value); err != nil {
+			return nil, fmt.Errorf("invalid JWT_KEY_ROTATED_AT: %v", err)
+		}
+	} else if len(jwtPreviousKeyFiles) > 0 {
+		return nil, fmt.Errorf("JWT_PREVIOUS_KEY_FILES requires JWT_KEY_ROTATED_AT")
+	}
+
+	smtpPort, err := strconv.Atoi(getEnv("SMTP_PORT", "587"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP_PORT: %v", err)
+	}
+
+	var allowedOrigins []string
+	for _, origin := range strings.Split(getEnv("ALLOWED_ORIGINS", "http://localhost:8000"), ",") {
+		if origin = strings.TrimSuffix(strings.TrimSpace(origin), "/"); origin != "" {
+			allowedOrigins = append(allowedOrigins, origin)
+		}
+	}
+
+	cfg := &Config{
+		AppEnv:     getEnv("APP_ENV", "development"),
 		ServerPort: getEnv("SERVER_PORT", "8080"),
-		JWTSecret:  getEnv("JWT_SECRET", "your_jwt_secret"),
+		JWTSecret:  getEnv("JWT_SECRET", defaultJWTSecret),
 		DBHost:     getEnv("DB_HOST", "localhost"),
 		DBUser:     getEnv("DB_USER", "postgres"),
 		DBPassword: getEnv("DB_PASSWORD", ""),
 		DBName:     getEnv("DB_NAME", "craftdb"),
 		DBPort:     getEnv("DB_PORT", "5432"),
-	}, nil
+
+		VersionCoalesceWindow: versionCoalesceWindow,
+		CollabPersistInterval: collabPersistInterval,
+		ShareSweepInterval:    shareSweepInterval,
+		ShareExpiryWarning:    shareExpiryWarning,
+		AccessTokenTTL:        accessTokenTTL,
+		RefreshTokenTTL:       refreshTokenTTL,
+
+		JWTSigningKeyFile:   os.Getenv("JWT_SIGNING_KEY_FILE"),
+		JWTPreviousKeyFiles: jwtPreviousKeyFiles,
+		JWTKeyRotatedAt:     jwtKeyRotatedAt,
+		JWTKeyRotationGrace: jwtKeyRotationGrace,
+
+		AppBaseURL:     strings.TrimSuffix(getEnv("APP_BASE_URL", "http://localhost:8000"), "/"),
+		AllowedOrigins: allowedOrigins,
+		MailDriver:     getEnv("MAIL_DRIVER", "log"),
+		MailFrom:       getEnv("MAIL_FROM", "Nexus <no-reply@localhost>"),
+		MailDir:        getEnv("MAIL_DIR", "mail"),
+		SMTPHost:       os.Getenv("SMTP_HOST"),
+		SMTPPort:       smtpPort,
+		SMTPUsername:   os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:   os.Getenv("SMTP_PASSWORD"),
+	}
+
+	switch cfg.MailDriver {
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("MAIL_DRIVER=smtp requires SMTP_HOST")
+		}
+	case "file", "log":
+		// Такие письма со ссылками для сброса пароля оседают в логах и на диске.
+		if cfg.IsProduction() {
+			return nil, fmt.Errorf("MAIL_DRIVER=%s is for development only: use smtp in production", cfg.MailDriver)
+		}
+	default:
+		return nil, fmt.Errorf("MAIL_DRIVER must be smtp, file or log")
+	}
+
+	if cfg.IsProduction() && cfg.JWTSigningKeyFile == "" && cfg.JWTSecret == defaultJWTSecret {
+		return nil, fmt.Errorf("refusing to start in production with the default JWT_SECRET: set JWT_SIGNING_KEY_FILE or JWT_SECRET")
+	}
+	if len(cfg.JWTPreviousKeyFiles) > 0 && cfg.JWTSigningKeyFile == "" {
+		return nil, fmt.Errorf("JWT_PREVIOUS_KEY_FILES requires JWT_SIGNING_KEY_FILE")
+	}
+
+	return cfg, nil
 }
 
 func getEnv(key, defaultValue string) string {
@@ -41,3 +216,16 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+func getDurationEnv(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", key, err)
+	}
+	return duration, nil
+}
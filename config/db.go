@@ -28,7 +28,10 @@ func InitDB(cfg *Config) (*gorm.DB, error) {
 		return nil, fmt.Errorf("не удалось подключиться к базе данных: %v", err)
 	}
 
-	if err := db.AutoMigrate(&models.User{}, &models.Folder{}); err != nil {
+	// Адреса аккаунтов, созданных до появления подтверждения, считаются подтверждёнными.
+	verifyExistingUsers := db.Migrator().HasTable(&models.User{}) && !db.Migrator().HasColumn(&models.User{}, "EmailVerifiedAt")
+
+	if err := db.AutoMigrate(&models.User{}, &models.Workspace{}, &models.WorkspaceMember{}, &models.Folder{}); err != nil {
 		log.Printf("Ошибка миграции базы данных для User и Folder: %v", err)
 		return nil, err
 	}
@@ -39,11 +42,34 @@ func InitDB(cfg *Config) (*gorm.DB, error) {
 		&models.Version{},
 		&models.Share{},
 		&models.Attachment{},
+		&models.Comment{},
+		&models.Notification{},
+		&models.Suggestion{},
+		&models.ShareLink{},
+		&models.OwnershipTransfer{},
+		&models.AuditLog{},
+		&models.RefreshToken{},
+		&models.RevokedToken{},
+		&models.RecoveryCode{},
+		&models.LoginChallenge{},
+		&models.UserToken{},
 	); err != nil {
 		log.Printf("Ошибка миграции базы данных для остальных моделей: %v", err)
 		return nil, err
 	}
 
+	if verifyExistingUsers {
+		if err := db.Exec("UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL").Error; err != nil {
+			log.Printf("Ошибка подтверждения адресов существующих пользователей: %v", err)
+			return nil, err
+		}
+	}
+
+	if err := migrateLegacyShares(db); err != nil {
+		log.Printf("Ошибка переноса прав доступа в shares: %v", err)
+		return nil, err
+	}
+
 	log.Println("Успешное подключение к базе данных!")
 	return db, nil
 }
@@ -0,0 +1,19 @@
+package config
+
+import (
+	"log"
+
+	"github.com/NutsBalls/Nexus/utils"
+)
+
+// LoadKeySet возвращает ключи для подписи и проверки JWT.
+func LoadKeySet(cfg *Config) (*utils.KeySet, error) {
+	if cfg.JWTSigningKeyFile == "" {
+		if cfg.IsProduction() {
+			log.Println("JWT подписываются общим секретом HS256: другие сервисы не смогут проверять токены через JWKS")
+		}
+		return utils.NewHMACKeySet([]byte(cfg.JWTSecret)), nil
+	}
+
+	return utils.LoadKeySet(cfg.JWTSigningKeyFile, cfg.JWTPreviousKeyFiles, cfg.JWTKeyRotatedAt.Add(cfg.JWTKeyRotationGrace))
+}
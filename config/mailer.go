@@ -0,0 +1,16 @@
+package config
+
+import (
+	"github.com/NutsBalls/Nexus/services"
+)
+
+func NewMailer(cfg *Config) services.Mailer {
+	switch cfg.MailDriver {
+	case "smtp":
+		return services.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	case "file":
+		return services.NewDevMailer(cfg.MailDir, cfg.MailFrom)
+	default:
+		return services.NewDevMailer("", cfg.MailFrom)
+	}
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// migrateLegacyShares переносит права доступа из устаревших таблиц
+// document_shares и collaborations в shares и удаляет эти таблицы.
+// Если у пользователя уже есть запись в shares, она не меняется.
+func migrateLegacyShares(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		migrator := tx.Migrator()
+
+		if migrator.HasTable("document_shares") {
+			result := tx.Exec(`
+				INSERT INTO shares (document_id, user_id, permission, created_by_id, created_at, updated_at)
+				SELECT DISTINCT ds.document_id, ds.user_id, 'read', d.user_id, NOW(), NOW()
+				FROM document_shares ds
+				JOIN documents d ON d.id = ds.document_id
+				WHERE ds.user_id <> d.user_id
+				AND NOT EXISTS (
+					SELECT 1 FROM shares s WHERE s.document_id = ds.document_id AND s.user_id = ds.user_id
+				)`)
+			if result.Error != nil {
+				return result.Error
+			}
+			log.Printf("Перенесено записей из document_shares: %d", result.RowsAffected)
+
+			if err := migrator.DropTable("document_shares"); err != nil {
+				return err
+			}
+		}
+
+		if migrator.HasTable("collaborations") {
+			// Из нескольких ролей одного пользователя берётся старшая,
+			// истёкшие и удалённые записи не переносятся.
+			result := tx.Exec(`
+				INSERT INTO shares (document_id, user_id, permission, created_by_id, created_at, updated_at, expires_at)
+				SELECT DISTINCT ON (c.document_id, c.user_id)
+					c.document_id,
+					c.user_id,
+					CASE c.role WHEN 'admin' THEN 'admin' WHEN 'editor' THEN 'write' ELSE 'read' END,
+					d.user_id,
+					c.created_at,
+					NOW(),
+					c.expires_at
+				FROM collaborations c
+				JOIN documents d ON d.id = c.document_id
+				WHERE c.deleted_at IS NULL
+				AND (c.expires_at IS NULL OR c.expires_at > NOW())
+				AND c.user_id <> d.user_id
+				AND NOT EXISTS (
+					SELECT 1 FROM shares s WHERE s.document_id = c.document_id AND s.user_id = c.user_id
+				)
+				ORDER BY c.document_id, c.user_id,
+					CASE c.role WHEN 'admin' THEN 3 WHEN 'editor' THEN 2 ELSE 1 END DESC,
+					c.expires_at DESC NULLS FIRST`)
+			if result.Error != nil {
+				return result.Error
+			}
+			log.Printf("Перенесено записей из collaborations: %d", result.RowsAffected)
+
+			if err := migrator.DropTable("collaborations"); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/services"
+	"github.com/NutsBalls/Nexus/utils"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
+	"gorm.io/gorm"
+)
+
+type CollabController struct {
+	DB             *gorm.DB
+	Hub            *services.CollabHub
+	AllowedOrigins []string
+}
+
+func NewCollabController(db *gorm.DB, hub *services.CollabHub, allowedOrigins []string) *CollabController {
+	return &CollabController{DB: db, Hub: hub, AllowedOrigins: allowedOrigins}
+}
+
+type collabRequest struct {
+	Type      string              `json:"type"`
+	Revision  int                 `json:"revision"`
+	Operation utils.TextOperation `json:"operation"`
+	Cursor    *services.Cursor    `json:"cursor"`
+}
+
+// @Summary Совместное редактирование
+// @Tags collaboration
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Param ticket query string false "Одноразовый билет вместо заголовка Authorization"
+// @Success 101 "Switching Protocols"
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/collab [get]
+func (cc *CollabController) Connect(c echo.Context) error {
+	documentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid document ID"})
+	}
+
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
+	var document models.Document
+	if err := cc.DB.First(&document, documentID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Document not found"})
+	}
+
+	canWrite, err := services.HasWriteAccess(cc.DB, &document, claims.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check access rights"})
+	}
+
+	server := websocket.Server{Handshake: cc.checkOrigin, Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+
+		client := services.NewCollabClient(claims.ID, claims.Username, canWrite)
+		if err := cc.Hub.Join(document.ID, client); err != nil {
+			log.Printf("Failed to join collaborative session for document %d: %v", document.ID, err)
+			websocket.JSON.Send(ws, services.CollabMessage{Type: services.CollabMessageError, Error: "Failed to open document"})
+			return
+		}
+		defer cc.Hub.Leave(client)
+
+		go func() {
+			for msg := range client.Send {
+				if err := websocket.JSON.Send(ws, msg); err != nil {
+					break
+				}
+			}
+			ws.Close()
+		}()
+
+		for {
+			var data []byte
+			if err := websocket.Message.Receive(ws, &data); err != nil {
+				return
+			}
+
+			var req collabRequest
+			if err := json.Unmarshal(data, &req); err != nil {
+				log.Printf("Invalid collab message from user %d: %v", claims.ID, err)
+				continue
+			}
+
+			switch req.Type {
+			case services.CollabMessageOperation:
+				cc.Hub.Submit(client, req.Revision, req.Operation)
+			case services.CollabMessageCursor:
+				if req.Cursor != nil {
+					cc.Hub.MoveCursor(client, req.Revision, *req.Cursor)
+				}
+			}
+		}
+	}}
+
+	server.ServeHTTP(c.Response(), c.Request())
+	return nil
+}
+
+// checkOrigin не даёт чужим сайтам открыть сокет от имени пользователя.
+func (cc *CollabController) checkOrigin(config *websocket.Config, req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+	if parsed.Host == req.Host {
+		return nil
+	}
+	for _, allowed := range cc.AllowedOrigins {
+		if strings.EqualFold(origin, allowed) {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %s is not allowed", origin)
+}
+
+// @Summary Участники, открывшие документ
+// @Tags collaboration
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Success 200 {array} services.Presence
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /api/documents/{id}/presence [get]
+func (cc *CollabController) GetPresence(c echo.Context) error {
+	documentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid document ID"})
+	}
+
+	return c.JSON(http.StatusOK, cc.Hub.Presence(uint(documentID)))
+}
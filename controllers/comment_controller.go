@@ -1,10 +1,15 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/services"
 	"github.com/NutsBalls/Nexus/utils"
 	"github.com/golang-jwt/jwt"
 	"github.com/labstack/echo/v4"
@@ -12,13 +17,29 @@ import (
 )
 
 type CommentController struct {
-	DB *gorm.DB
+	DB                  *gorm.DB
+	NotificationService *services.NotificationService
+	MentionService      *services.MentionService
 }
 
-func NewCommentController(db *gorm.DB) *CommentController {
-	return &CommentController{DB: db}
+func NewCommentController(db *gorm.DB, notificationService *services.NotificationService, mentionService *services.MentionService) *CommentController {
+	return &CommentController{DB: db, NotificationService: notificationService, MentionService: mentionService}
 }
 
+// @Summary Добавить комментарий
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Param comment body models.Comment true "Комментарий"
+// @Success 201 {object} models.Comment
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/comments [post]
 func (cc *CommentController) AddComment(c echo.Context) error {
 	documentIDStr := c.Param("id")
 	documentID, err := strconv.ParseUint(documentIDStr, 10, 64)
@@ -33,6 +54,49 @@ func (cc *CommentController) AddComment(c echo.Context) error {
 	if err := c.Bind(comment); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
 	}
+	comment.Resolved = false
+	comment.ResolvedByID = nil
+	comment.ResolvedAt = nil
+	comment.Orphaned = false
+	comment.AnchorText = ""
+
+	var document models.Document
+	if err := cc.DB.First(&document, documentID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Document not found"})
+	}
+
+	if comment.AnchorStart != nil || comment.AnchorEnd != nil {
+		if comment.ParentID != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Replies cannot be anchored to text"})
+		}
+		if comment.AnchorStart == nil || comment.AnchorEnd == nil ||
+			*comment.AnchorStart < 0 || *comment.AnchorStart >= *comment.AnchorEnd ||
+			*comment.AnchorEnd > utils.UTF16Len(document.Content) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid anchor range"})
+		}
+		comment.AnchorText = utils.SliceUTF16(document.Content, *comment.AnchorStart, *comment.AnchorEnd)
+	}
+
+	if comment.ParentID != nil {
+		var parent models.Comment
+		if err := cc.DB.Where("id = ? AND document_id = ?", *comment.ParentID, document.ID).First(&parent).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Parent comment not found in this document"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check parent comment"})
+		}
+	}
+
+	mentions, withoutAccess, err := cc.MentionService.Resolve(&document, utils.ParseMentions(comment.Content))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to resolve mentions"})
+	}
+	if len(withoutAccess) > 0 {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":                "Mentioned users do not have access to the document",
+			"users_without_access": withoutAccess,
+		})
+	}
 
 	comment.DocumentID = uint(documentID)
 	comment.UserID = claims.ID
@@ -41,9 +105,45 @@ func (cc *CommentController) AddComment(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to add comment"})
 	}
 
+	content := fmt.Sprintf("%s commented on \"%s\"", claims.Username, document.Title)
+	if err := cc.NotificationService.NotifyCollaborators(document.ID, claims.ID, models.NotificationComment, content); err != nil {
+		log.Printf("Failed to notify about comment %d: %v", comment.ID, err)
+	}
+	if err := cc.MentionService.NotifyComment(&document, comment, claims, mentions); err != nil {
+		log.Printf("Failed to notify mentions in comment %d: %v", comment.ID, err)
+	}
+
 	return c.JSON(http.StatusCreated, comment)
 }
 
+type commentWithAuthor struct {
+	models.Comment
+	Username string `json:"username"`
+}
+
+type commentNode struct {
+	commentWithAuthor
+	ReplyCount int            `json:"reply_count"`
+	Replies    []*commentNode `json:"replies"`
+}
+
+// GetComments возвращает ветки обсуждения документа, новые сверху. У каждой
+// ветки показываются первые replies_limit ответов, остальные доступны через
+// GetReplies. Ответы загружаются только для веток текущей страницы.
+//
+// @Summary Получить обсуждения документа
+// @Tags comments
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Param page query int false "Номер страницы"
+// @Param limit query int false "Размер страницы"
+// @Param replies_limit query int false "Сколько первых ответов вернуть в каждой ветке"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/comments [get]
 func (cc *CommentController) GetComments(c echo.Context) error {
 	documentIDStr := c.Param("id")
 	documentID, err := strconv.ParseUint(documentIDStr, 10, 64)
@@ -51,24 +151,314 @@ func (cc *CommentController) GetComments(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid document ID"})
 	}
 
-	var comments []struct {
-		models.Comment
-		Username string `json:"username"`
+	page, limit := parsePagination(c, 20)
+	repliesLimit := 3
+	if v, err := strconv.Atoi(c.QueryParam("replies_limit")); err == nil && v >= 0 {
+		repliesLimit = min(v, maxPageLimit)
+	}
+
+	var total int64
+	if err := cc.DB.Model(&models.Comment{}).
+		Where("document_id = ? AND parent_id IS NULL", documentID).
+		Count(&total).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch comments"})
+	}
+
+	var roots []commentWithAuthor
+	if err := cc.commentsQuery(uint(documentID)).
+		Where("comments.parent_id IS NULL").
+		Order("comments.created_at DESC, comments.id DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&roots).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch comments"})
+	}
+
+	threads := make([]*commentNode, 0, len(roots))
+	for _, root := range roots {
+		threads = append(threads, newCommentNode(root))
+	}
+	if err := cc.attachFirstReplies(uint(documentID), threads, repliesLimit); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch comments"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"threads": threads,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// GetReplies постранично возвращает прямые ответы на комментарий вместе
+// с их вложенными ответами.
+//
+// @Summary Получить ответы на комментарий
+// @Tags comments
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Param commentId path int true "ID комментария"
+// @Param page query int false "Номер страницы"
+// @Param limit query int false "Размер страницы"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/comments/{commentId}/replies [get]
+func (cc *CommentController) GetReplies(c echo.Context) error {
+	documentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid document ID"})
+	}
+	commentID, err := strconv.ParseUint(c.Param("commentId"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid comment ID"})
+	}
+
+	page, limit := parsePagination(c, 20)
+
+	var comment models.Comment
+	if err := cc.DB.Where("id = ? AND document_id = ?", commentID, documentID).First(&comment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Comment not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch comments"})
+	}
+
+	var total int64
+	if err := cc.DB.Model(&models.Comment{}).Where("parent_id = ?", comment.ID).Count(&total).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch comments"})
+	}
+
+	var replies []commentWithAuthor
+	if err := cc.commentsQuery(uint(documentID)).
+		Where("comments.parent_id = ?", comment.ID).
+		Order("comments.created_at ASC, comments.id ASC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&replies).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch comments"})
+	}
+
+	nodes := make([]*commentNode, 0, len(replies))
+	for _, reply := range replies {
+		nodes = append(nodes, newCommentNode(reply))
+	}
+	if err := cc.attachReplies(uint(documentID), nodes); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch comments"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"replies": nodes,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// @Summary Закрыть обсуждение
+// @Tags comments
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Param commentId path int true "ID комментария"
+// @Success 200 {object} models.Comment
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/comments/{commentId}/resolve [put]
+func (cc *CommentController) ResolveThread(c echo.Context) error {
+	return cc.setThreadResolved(c, true)
+}
+
+// @Summary Открыть обсуждение заново
+// @Tags comments
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Param commentId path int true "ID комментария"
+// @Success 200 {object} models.Comment
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/comments/{commentId}/reopen [put]
+func (cc *CommentController) ReopenThread(c echo.Context) error {
+	return cc.setThreadResolved(c, false)
+}
+
+func (cc *CommentController) setThreadResolved(c echo.Context, resolved bool) error {
+	documentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid document ID"})
+	}
+	commentID, err := strconv.ParseUint(c.Param("commentId"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid comment ID"})
+	}
+
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(*utils.JWTCustomClaims)
+
+	var document models.Document
+	if err := cc.DB.First(&document, documentID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Document not found"})
+	}
+
+	var comment models.Comment
+	if err := cc.DB.Where("id = ? AND document_id = ?", commentID, document.ID).First(&comment).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Comment not found"})
+	}
+
+	if comment.ParentID != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Only a thread's first comment can be resolved"})
+	}
+
+	isOwner, err := services.HasPermission(cc.DB, &document, claims.ID, models.PermissionOwner)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check access rights"})
+	}
+	if !isOwner && comment.UserID != claims.ID {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Only the document owner or the comment author can change thread status"})
+	}
+
+	comment.Resolved = resolved
+	if resolved {
+		now := time.Now()
+		comment.ResolvedByID = &claims.ID
+		comment.ResolvedAt = &now
+	} else {
+		comment.ResolvedByID = nil
+		comment.ResolvedAt = nil
 	}
 
-	if err := cc.DB.Table("comments").
+	if err := cc.DB.Model(&comment).Select("resolved", "resolved_by_id", "resolved_at").Updates(&comment).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update comment"})
+	}
+
+	return c.JSON(http.StatusOK, comment)
+}
+
+func newCommentNode(comment commentWithAuthor) *commentNode {
+	return &commentNode{commentWithAuthor: comment, Replies: []*commentNode{}}
+}
+
+// commentsQuery выбирает неудалённые комментарии документа вместе с именем автора.
+func (cc *CommentController) commentsQuery(documentID uint) *gorm.DB {
+	return cc.DB.Table("comments").
 		Select("comments.*, users.username").
 		Joins("JOIN users ON users.id = comments.user_id").
-		Where("comments.document_id = ?", documentID).
-		Order("comments.created_at DESC").
-		Find(&comments).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch comments"})
+		Where("comments.document_id = ? AND comments.deleted_at IS NULL", documentID)
+}
+
+// attachFirstReplies подгружает веткам число прямых ответов и первые limit
+// из них вместе со всеми вложенными ответами.
+func (cc *CommentController) attachFirstReplies(documentID uint, threads []*commentNode, limit int) error {
+	if len(threads) == 0 {
+		return nil
+	}
+
+	byID := make(map[uint]*commentNode, len(threads))
+	ids := make([]uint, 0, len(threads))
+	for _, thread := range threads {
+		byID[thread.ID] = thread
+		ids = append(ids, thread.ID)
 	}
 
-	return c.JSON(http.StatusOK, comments)
+	var counts []struct {
+		ParentID uint
+		Count    int
+	}
+	if err := cc.DB.Model(&models.Comment{}).
+		Select("parent_id, COUNT(*) AS count").
+		Where("parent_id IN ?", ids).
+		Group("parent_id").
+		Scan(&counts).Error; err != nil {
+		return err
+	}
+	for _, count := range counts {
+		byID[count.ParentID].ReplyCount = count.Count
+	}
+
+	if limit == 0 {
+		return nil
+	}
+
+	ranked := cc.commentsQuery(documentID).
+		Select("comments.*, users.username, ROW_NUMBER() OVER (PARTITION BY comments.parent_id ORDER BY comments.created_at, comments.id) AS reply_rank").
+		Where("comments.parent_id IN ?", ids)
+
+	var replies []commentWithAuthor
+	if err := cc.DB.Table("(?) AS ranked", ranked).
+		Where("ranked.reply_rank <= ?", limit).
+		Order("ranked.created_at ASC, ranked.id ASC").
+		Find(&replies).Error; err != nil {
+		return err
+	}
+
+	nodes := make([]*commentNode, 0, len(replies))
+	for _, reply := range replies {
+		node := newCommentNode(reply)
+		parent := byID[*reply.ParentID]
+		parent.Replies = append(parent.Replies, node)
+		nodes = append(nodes, node)
+	}
+	return cc.attachReplies(documentID, nodes)
+}
+
+// attachReplies загружает все вложенные ответы на комментарии nodes,
+// по одному запросу на уровень вложенности.
+func (cc *CommentController) attachReplies(documentID uint, nodes []*commentNode) error {
+	for len(nodes) > 0 {
+		byID := make(map[uint]*commentNode, len(nodes))
+		ids := make([]uint, 0, len(nodes))
+		for _, node := range nodes {
+			byID[node.ID] = node
+			ids = append(ids, node.ID)
+		}
+
+		var replies []commentWithAuthor
+		if err := cc.commentsQuery(documentID).
+			Where("comments.parent_id IN ?", ids).
+			Order("comments.created_at ASC, comments.id ASC").
+			Find(&replies).Error; err != nil {
+			return err
+		}
+
+		next := make([]*commentNode, 0, len(replies))
+		for _, reply := range replies {
+			node := newCommentNode(reply)
+			parent := byID[*reply.ParentID]
+			parent.Replies = append(parent.Replies, node)
+			parent.ReplyCount++
+			next = append(next, node)
+		}
+		nodes = next
+	}
+	return nil
 }
 
+// DeleteComment удаляет комментарий автора вместе со всеми ответами на него.
+//
+// @Summary Удалить комментарий
+// @Tags comments
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Param commentId path int true "ID комментария"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/comments/{commentId} [delete]
 func (cc *CommentController) DeleteComment(c echo.Context) error {
+	documentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid document ID"})
+	}
 	commentIDStr := c.Param("commentId")
 	commentID, err := strconv.ParseUint(commentIDStr, 10, 64)
 	if err != nil {
@@ -78,13 +468,44 @@ func (cc *CommentController) DeleteComment(c echo.Context) error {
 	user := c.Get("user").(*jwt.Token)
 	claims := user.Claims.(*utils.JWTCustomClaims)
 
-	result := cc.DB.Where("id = ? AND user_id = ?", commentID, claims.ID).Delete(&models.Comment{})
-	if result.Error != nil {
+	var comment models.Comment
+	if err := cc.DB.Where("id = ? AND document_id = ?", commentID, documentID).First(&comment).Error; err != nil &&
+		!errors.Is(err, gorm.ErrRecordNotFound) {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete comment"})
 	}
-	if result.RowsAffected == 0 {
+	if comment.ID == 0 || comment.UserID != claims.ID {
 		return c.JSON(http.StatusForbidden, map[string]string{"error": "Not authorized to delete this comment"})
 	}
 
+	// Собираем ветку ответов уровень за уровнем.
+	ids := []uint{comment.ID}
+	for level := []uint{comment.ID}; len(level) > 0; {
+		var children []uint
+		if err := cc.DB.Model(&models.Comment{}).Where("parent_id IN ?", level).Pluck("id", &children).Error; err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete comment"})
+		}
+		ids = append(ids, children...)
+		level = children
+	}
+
+	if err := cc.DB.Where("id IN ?", ids).Delete(&models.Comment{}).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete comment"})
+	}
+
 	return c.NoContent(http.StatusNoContent)
 }
+
+const maxPageLimit = 100
+
+func parsePagination(c echo.Context, defaultLimit int) (int, int) {
+	page, err := strconv.Atoi(c.QueryParam("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err := strconv.Atoi(c.QueryParam("limit"))
+	if err != nil || limit < 1 {
+		limit = defaultLimit
+	}
+	return page, min(limit, maxPageLimit)
+}
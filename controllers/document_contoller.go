@@ -10,45 +10,88 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/services"
 	"github.com/NutsBalls/Nexus/utils"
 	"github.com/golang-jwt/jwt"
 
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errRevisionConflict = errors.New("revision conflict")
+	errMoveForbidden    = errors.New("only the owner can move the document")
 )
 
 type DocumentController struct {
-	DB *gorm.DB
+	DB             *gorm.DB
+	VersionService *services.VersionService
+	MentionService *services.MentionService
 }
 
 type CreateDocumentRequest struct {
-	Title    string `json:"title" example:"Мой документ"`
-	Content  string `json:"content" example:"Содержимое документа"`
-	FolderID *uint  `json:"folder_id,omitempty" example:"1"`
-	IsPublic bool   `json:"is_public" example:"false"`
+	Title       string `json:"title" example:"Мой документ"`
+	Content     string `json:"content" example:"Содержимое документа"`
+	FolderID    *uint  `json:"folder_id,omitempty" example:"1"`
+	WorkspaceID *uint  `json:"workspace_id,omitempty" example:"1"`
+}
+
+// UpdateDocumentRequest перечисляет поля, которые можно изменить через PUT.
+// Поля, не переданные в запросе, сохраняют текущие значения.
+type UpdateDocumentRequest struct {
+	Title       string `json:"title" example:"Мой документ"`
+	Content     string `json:"content" example:"Содержимое документа"`
+	FolderID    *uint  `json:"folder_id" example:"1"`
+	WorkspaceID *uint  `json:"workspace_id" example:"1"`
 }
 
-func NewDocumentController(db *gorm.DB) *DocumentController {
-	return &DocumentController{DB: db}
+func NewDocumentController(db *gorm.DB, versionService *services.VersionService, mentionService *services.MentionService) *DocumentController {
+	return &DocumentController{DB: db, VersionService: versionService, MentionService: mentionService}
 }
 
+// @Summary Получить список всех документов
+// @Description Возвращает документы, доступные пользователю
+// @Tags documents
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Document
+// @Failure 500 {object} map[string]string
+// @Router /api/documents [get]
 func (dc *DocumentController) GetDocuments(c echo.Context) error {
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
 	var documents []models.Document
-	if err := dc.DB.Find(&documents).Error; err != nil {
+	if err := dc.DB.Scopes(services.AccessibleDocuments(claims.ID)).Find(&documents).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch documents"})
 	}
 	return c.JSON(http.StatusOK, documents)
 }
 
+// @Summary Создать новый документ
+// @Description Создает новый документ для текущего пользователя
+// @Tags documents
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param document body controllers.CreateDocumentRequest true "Данные документа"
+// @Success 201 {object} models.Document
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents [post]
 func (dc *DocumentController) CreateDocument(c echo.Context) error {
 	type CreateDocumentRequest struct {
-		Title    string `json:"title" binding:"required"`
-		Content  string `json:"content"`
-		FolderID *uint  `json:"folder_id,omitempty"`
-		IsPublic bool   `json:"is_public"`
+		Title       string `json:"title" binding:"required"`
+		Content     string `json:"content"`
+		FolderID    *uint  `json:"folder_id,omitempty"`
+		WorkspaceID *uint  `json:"workspace_id,omitempty"`
 	}
 
 	req := new(CreateDocumentRequest)
@@ -67,20 +110,27 @@ func (dc *DocumentController) CreateDocument(c echo.Context) error {
 	}
 
 	document := &models.Document{
-		Title:    req.Title,
-		Content:  req.Content,
-		UserID:   claims.ID,
-		FolderID: req.FolderID,
-		IsPublic: req.IsPublic,
+		Title:       req.Title,
+		Content:     req.Content,
+		UserID:      claims.ID,
+		FolderID:    req.FolderID,
+		WorkspaceID: req.WorkspaceID,
+		Revision:    1,
 	}
 
-	if document.FolderID != nil {
-		var folder models.Folder
-		if err := dc.DB.First(&folder, *document.FolderID).Error; err != nil {
-			return c.JSON(http.StatusBadRequest, map[string]string{
-				"error": "Folder not found",
-			})
-		}
+	if status, message := dc.checkPlacement(document, claims.ID); status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	mentions, withoutAccess, err := dc.MentionService.Resolve(document, utils.ParseMentions(document.Content))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to resolve mentions"})
+	}
+	if len(withoutAccess) > 0 {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":                "Mentioned users do not have access to the document",
+			"users_without_access": withoutAccess,
+		})
 	}
 
 	if err := dc.DB.Create(document).Error; err != nil {
@@ -90,36 +140,247 @@ func (dc *DocumentController) CreateDocument(c echo.Context) error {
 		})
 	}
 
+	if err := dc.MentionService.NotifyDocument(document, claims, mentions); err != nil {
+		log.Printf("Failed to notify mentions in document %d: %v", document.ID, err)
+	}
+
 	return c.JSON(http.StatusCreated, document)
 }
 
+// @Summary Получить документ по ID
+// @Description Возвращает документ по указанному идентификатору. Заголовок ETag содержит ревизию
+// @Tags documents
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Success 200 {object} models.Document
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/documents/{id} [get]
 func (dc *DocumentController) GetDocument(c echo.Context) error {
 	id := c.Param("id")
 	document := new(models.Document)
 	if err := dc.DB.First(document, id).Error; err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Document not found"})
 	}
+	c.Response().Header().Set("ETag", documentETag(document.Revision))
 	return c.JSON(http.StatusOK, document)
 }
 
+// @Summary Обновить документ
+// @Description Обновляет существующий документ. При несовпадении If-Match возвращает 409 и текущий документ
+// @Tags documents
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Param If-Match header string false "ETag ревизии, поверх которой сделаны правки"
+// @Param document body controllers.UpdateDocumentRequest true "Обновленные данные документа"
+// @Success 200 {object} models.Document
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id} [put]
 func (dc *DocumentController) UpdateDocument(c echo.Context) error {
 	id := c.Param("id")
 	document := new(models.Document)
 	if err := dc.DB.First(document, id).Error; err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Document not found"})
 	}
+	documentID := document.ID
+	previousContent := document.Content
+	previousFolderID := document.FolderID
+	previousWorkspaceID := document.WorkspaceID
 
-	if err := c.Bind(document); err != nil {
+	// Владелец, доступы и теги меняются только через свои маршруты.
+	req := UpdateDocumentRequest{
+		Title:       document.Title,
+		Content:     document.Content,
+		FolderID:    copyID(document.FolderID),
+		WorkspaceID: copyID(document.WorkspaceID),
+	}
+	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
 	}
+	document.Title = req.Title
+	document.Content = req.Content
+	document.FolderID = req.FolderID
+	document.WorkspaceID = req.WorkspaceID
+
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
+	moved := !sameID(previousFolderID, document.FolderID) || !sameID(previousWorkspaceID, document.WorkspaceID)
+	if moved {
+		// Перенос меняет круг людей с доступом, поэтому доступен только владельцу.
+		permission, err := services.DocumentPermission(dc.DB, document, claims.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check access rights"})
+		}
+		if permission != models.PermissionOwner {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Only the owner can move the document"})
+		}
+		if document.FolderID != nil && sameID(previousWorkspaceID, document.WorkspaceID) {
+			// Пространство берётся из новой папки.
+			document.WorkspaceID = nil
+		}
+		if status, message := dc.checkPlacement(document, claims.ID); status != 0 {
+			return c.JSON(status, map[string]string{"error": message})
+		}
+	}
+
+	mentions, withoutAccess, err := dc.MentionService.Resolve(document, services.NewMentions(previousContent, document.Content))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to resolve mentions"})
+	}
+	if len(withoutAccess) > 0 {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":                "Mentioned users do not have access to the document",
+			"users_without_access": withoutAccess,
+		})
+	}
+	ifMatch := c.Request().Header.Get("If-Match")
+
+	var current, updated models.Document
+	err = dc.DB.Transaction(func(tx *gorm.DB) error {
+		// Блокируем строку, чтобы проверка ревизии и сохранение были атомарными.
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, documentID).Error; err != nil {
+			return err
+		}
+		if ifMatch != "" && !etagMatches(ifMatch, current.Revision) {
+			return errRevisionConflict
+		}
+		// Документ могли передать другому владельцу после проверки выше.
+		if moved && current.UserID != claims.ID {
+			return errMoveForbidden
+		}
+
+		// Остальные поля берутся из заблокированной строки, а не из копии,
+		// прочитанной до блокировки.
+		updated = current
+		updated.Title = document.Title
+		updated.Content = document.Content
+		if moved {
+			updated.FolderID = document.FolderID
+			updated.WorkspaceID = document.WorkspaceID
+		}
 
-	if err := dc.DB.Save(document).Error; err != nil {
+		if err := dc.VersionService.Snapshot(tx, current, updated, claims.ID); err != nil {
+			return err
+		}
+		if err := services.ReanchorDocument(tx, documentID, current.Content, updated.Content); err != nil {
+			return err
+		}
+		updated.Revision = current.Revision + 1
+		return tx.Model(&updated).
+			Select("title", "content", "folder_id", "workspace_id", "revision", "updated_at").
+			Updates(&updated).Error
+	})
+	if errors.Is(err, errMoveForbidden) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Only the owner can move the document"})
+	}
+	if errors.Is(err, errRevisionConflict) {
+		c.Response().Header().Set("ETag", documentETag(current.Revision))
+		return c.JSON(http.StatusConflict, map[string]interface{}{
+			"error":    "Document was modified by another user",
+			"document": current,
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to update document %d: %v", documentID, err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update document"})
 	}
 
-	return c.JSON(http.StatusOK, document)
+	if err := dc.MentionService.NotifyDocument(&updated, claims, mentions); err != nil {
+		log.Printf("Failed to notify mentions in document %d: %v", documentID, err)
+	}
+
+	c.Response().Header().Set("ETag", documentETag(updated.Revision))
+	return c.JSON(http.StatusOK, updated)
+}
+
+// checkPlacement проверяет, что пользователь может положить документ в
+// выбранную папку или рабочее пространство. Документ в папке наследует её
+// пространство. Возвращает HTTP-статус и текст ошибки или 0.
+func (dc *DocumentController) checkPlacement(document *models.Document, userID uint) (int, string) {
+	if document.FolderID != nil {
+		var folder models.Folder
+		if err := dc.DB.First(&folder, *document.FolderID).Error; err != nil {
+			return http.StatusBadRequest, "Folder not found"
+		}
+
+		// Документ в папке становится доступен всем, с кем она расшарена.
+		permission, err := services.FolderPermission(dc.DB, &folder, userID)
+		if err != nil {
+			return http.StatusInternalServerError, "Failed to check access rights"
+		}
+		if !services.PermissionAllows(permission, models.PermissionWrite) {
+			return http.StatusForbidden, "Access denied to folder"
+		}
+
+		if document.WorkspaceID != nil && !sameID(document.WorkspaceID, folder.WorkspaceID) {
+			return http.StatusBadRequest, "Folder belongs to a different workspace"
+		}
+		document.WorkspaceID = folder.WorkspaceID
+		return 0, ""
+	}
+
+	if document.WorkspaceID != nil {
+		role, err := services.WorkspaceRole(dc.DB, *document.WorkspaceID, userID)
+		if err != nil {
+			return http.StatusInternalServerError, "Failed to check access rights"
+		}
+		if !services.WorkspaceRoleAllows(role, models.WorkspaceRoleMember) {
+			return http.StatusForbidden, "Access denied to workspace"
+		}
+	}
+	return 0, ""
+}
+
+func sameID(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// copyID копирует идентификатор, чтобы разбор JSON не изменил исходное значение.
+func copyID(id *uint) *uint {
+	if id == nil {
+		return nil
+	}
+	value := *id
+	return &value
+}
+
+func documentETag(revision uint) string {
+	return fmt.Sprintf("\"%d\"", revision)
 }
 
+// etagMatches проверяет заголовок If-Match: список ETag через запятую или "*".
+func etagMatches(header string, revision uint) bool {
+	expected := documentETag(revision)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == expected {
+			return true
+		}
+	}
+	return false
+}
+
+// @Summary Удалить документ
+// @Description Удаляет документ по указанному идентификатору вместе с версиями, доступами и комментариями
+// @Tags documents
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Success 204
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id} [delete]
 func (dc *DocumentController) DeleteDocument(c echo.Context) error {
 	documentID := c.Param("id")
 	log.Printf("Attempting to delete document with ID: %s", documentID)
@@ -134,7 +395,11 @@ func (dc *DocumentController) DeleteDocument(c echo.Context) error {
 
 	user := c.Get("user").(*jwt.Token)
 	claims := user.Claims.(*utils.JWTCustomClaims)
-	if document.UserID != claims.ID {
+	isOwner, err := services.HasPermission(dc.DB, &document, claims.ID, models.PermissionOwner)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check access rights"})
+	}
+	if !isOwner {
 		return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied"})
 	}
 
@@ -158,6 +423,20 @@ func (dc *DocumentController) DeleteDocument(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete attachments"})
 	}
 
+	// Связанные записи удаляются явно: в базах, созданных раньше, у внешних
+	// ключей нет ON DELETE CASCADE.
+	related := []interface{}{
+		&models.Version{}, &models.Share{}, &models.ShareLink{},
+		&models.Comment{}, &models.Suggestion{}, &models.DocumentTag{},
+	}
+	for _, model := range related {
+		if err := tx.Unscoped().Where("document_id = ?", document.ID).Delete(model).Error; err != nil {
+			tx.Rollback()
+			log.Printf("Failed to delete records of document %d: %v", document.ID, err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete document"})
+		}
+	}
+
 	if err := tx.Delete(&document).Error; err != nil {
 		tx.Rollback()
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete document"})
@@ -170,6 +449,20 @@ func (dc *DocumentController) DeleteDocument(c echo.Context) error {
 	return c.NoContent(http.StatusNoContent)
 }
 
+// @Summary Создать новую версию документа
+// @Description Сохраняет текущее состояние документа отдельной версией
+// @Tags document versions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Param version body models.Version true "Данные версии"
+// @Success 201 {object} models.Version
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/versions [post]
 func (dc *DocumentController) CreateVersion(c echo.Context) error {
 	documentID := c.Param("id")
 	version := new(models.Version)
@@ -181,7 +474,10 @@ func (dc *DocumentController) CreateVersion(c echo.Context) error {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Document not found"})
 	}
 
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
 	version.DocumentID = document.ID
+	version.UserID = claims.ID
 	if err := dc.DB.Create(version).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create version"})
 	}
@@ -189,6 +485,16 @@ func (dc *DocumentController) CreateVersion(c echo.Context) error {
 	return c.JSON(http.StatusCreated, version)
 }
 
+// @Summary Получить версии документа
+// @Description Возвращает все версии указанного документа
+// @Tags document versions
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Success 200 {array} models.Version
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/versions [get]
 func (dc *DocumentController) GetVersions(c echo.Context) error {
 	documentID := c.Param("id")
 
@@ -200,6 +506,236 @@ func (dc *DocumentController) GetVersions(c echo.Context) error {
 	return c.JSON(http.StatusOK, versions)
 }
 
+// @Summary Восстановить версию документа
+// @Tags document versions
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Param versionId path int true "ID версии"
+// @Param If-Match header string false "ETag текущей ревизии"
+// @Success 200 {object} models.Document
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/versions/{versionId}/restore [post]
+func (dc *DocumentController) RestoreVersion(c echo.Context) error {
+	documentID := c.Param("id")
+	versionID := c.Param("versionId")
+
+	var document models.Document
+	if err := dc.DB.First(&document, documentID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Document not found"})
+	}
+
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
+	canWrite, err := services.HasWriteAccess(dc.DB, &document, claims.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check access rights"})
+	}
+	if !canWrite {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied"})
+	}
+
+	var version models.Version
+	if err := dc.DB.Where("id = ? AND document_id = ?", versionID, document.ID).First(&version).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Version not found"})
+	}
+
+	ifMatch := c.Request().Header.Get("If-Match")
+
+	var previousContent string
+	var current models.Document
+	err = dc.DB.Transaction(func(tx *gorm.DB) error {
+		// Как и в UpdateDocument, ревизия проверяется и увеличивается
+		// на заблокированной строке, а не на копии, прочитанной до транзакции.
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, document.ID).Error; err != nil {
+			return err
+		}
+		if ifMatch != "" && !etagMatches(ifMatch, current.Revision) {
+			return errRevisionConflict
+		}
+
+		previousContent = current.Content
+		if err := dc.VersionService.Restore(tx, &current, version, claims.ID); err != nil {
+			return err
+		}
+		return services.ReanchorDocument(tx, current.ID, previousContent, current.Content)
+	})
+	if errors.Is(err, errRevisionConflict) {
+		c.Response().Header().Set("ETag", documentETag(current.Revision))
+		return c.JSON(http.StatusConflict, map[string]interface{}{
+			"error":    "Document was modified by another user",
+			"document": current,
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to restore version %d of document %d: %v", version.ID, document.ID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to restore version"})
+	}
+
+	if err := dc.MentionService.NotifyNewMentions(&current, claims, previousContent, current.Content); err != nil {
+		log.Printf("Failed to notify mentions in document %d: %v", current.ID, err)
+	}
+
+	c.Response().Header().Set("ETag", documentETag(current.Revision))
+	return c.JSON(http.StatusOK, current)
+}
+
+type VersionDiffResponse struct {
+	From    string           `json:"from"`
+	To      string           `json:"to"`
+	Title   []utils.DiffHunk `json:"title"`
+	Unified string           `json:"unified"`
+	Lines   []utils.DiffHunk `json:"lines"`
+	Words   []utils.DiffHunk `json:"words"`
+}
+
+// @Summary Сравнить версии документа
+// @Tags document versions
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Param from query string true "ID версии или current"
+// @Param to query string false "ID версии или current, по умолчанию current"
+// @Success 200 {object} controllers.VersionDiffResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/documents/{id}/versions/diff [get]
+func (dc *DocumentController) DiffVersions(c echo.Context) error {
+	documentID := c.Param("id")
+
+	from := c.QueryParam("from")
+	if from == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Parameter 'from' is required"})
+	}
+	to := c.QueryParam("to")
+	if to == "" {
+		to = "current"
+	}
+
+	var document models.Document
+	if err := dc.DB.First(&document, documentID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Document not found"})
+	}
+
+	fromVersion, err := dc.findRevision(&document, from)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Version not found"})
+	}
+	toVersion, err := dc.findRevision(&document, to)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Version not found"})
+	}
+
+	return c.JSON(http.StatusOK, VersionDiffResponse{
+		From:    from,
+		To:      to,
+		Title:   utils.DiffWords(fromVersion.Title, toVersion.Title),
+		Unified: utils.UnifiedDiff(revisionLabel(from), revisionLabel(to), fromVersion.Content, toVersion.Content),
+		Lines:   utils.DiffLines(fromVersion.Content, toVersion.Content),
+		Words:   utils.DiffWords(fromVersion.Content, toVersion.Content),
+	})
+}
+
+type MergeRequest struct {
+	BaseVersionID uint   `json:"base_version_id"`
+	Content       string `json:"content"`
+}
+
+type MergeResponse struct {
+	utils.MergeResult
+	Revision uint `json:"revision"`
+}
+
+// MergeDocument сливает правки клиента, сделанные поверх версии base_version_id,
+// с текущим содержимым документа. Результат не сохраняется: клиент отправляет
+// его через PUT с If-Match на возвращённую ревизию.
+//
+// @Summary Слить правки с текущим документом
+// @Tags document versions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Param request body controllers.MergeRequest true "Версия, от которой начаты правки, и новый текст"
+// @Success 200 {object} controllers.MergeResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/documents/{id}/merge [post]
+func (dc *DocumentController) MergeDocument(c echo.Context) error {
+	documentID := c.Param("id")
+
+	req := new(MergeRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+	}
+	if req.BaseVersionID == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Base version ID is required"})
+	}
+
+	var document models.Document
+	if err := dc.DB.First(&document, documentID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Document not found"})
+	}
+
+	var base models.Version
+	if err := dc.DB.Where("id = ? AND document_id = ?", req.BaseVersionID, document.ID).First(&base).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Version not found"})
+	}
+
+	result := utils.Merge3(base.Content, req.Content, document.Content, "yours", "current")
+
+	c.Response().Header().Set("ETag", documentETag(document.Revision))
+	return c.JSON(http.StatusOK, MergeResponse{
+		MergeResult: result,
+		Revision:    document.Revision,
+	})
+}
+
+// findRevision возвращает версию документа по ID; "current" означает
+// текущее состояние документа.
+func (dc *DocumentController) findRevision(document *models.Document, ref string) (*models.Version, error) {
+	if ref == "current" {
+		return &models.Version{
+			DocumentID: document.ID,
+			Title:      document.Title,
+			Content:    document.Content,
+		}, nil
+	}
+
+	versionID, err := strconv.ParseUint(ref, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	var version models.Version
+	if err := dc.DB.Where("id = ? AND document_id = ?", versionID, document.ID).First(&version).Error; err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+func revisionLabel(ref string) string {
+	if ref == "current" {
+		return "current"
+	}
+	return "version " + ref
+}
+
+// @Summary Поиск документов
+// @Description Ищет документы по названию и содержимому
+// @Tags documents
+// @Produce json
+// @Security BearerAuth
+// @Param q query string true "Поисковый запрос"
+// @Success 200 {array} models.Document
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/search [get]
 func (dc *DocumentController) SearchDocuments(c echo.Context) error {
 	query := c.QueryParam("q")
 	if query == "" {
@@ -210,9 +746,8 @@ func (dc *DocumentController) SearchDocuments(c echo.Context) error {
 	claims := user.Claims.(*utils.JWTCustomClaims)
 
 	var documents []models.Document
-	if err := dc.DB.Where("user_id = ? AND (title ILIKE ? OR content ILIKE ?)",
-		claims.ID, "%"+query+"%", "%"+query+"%").
-		Or("id IN (SELECT document_id FROM document_shares WHERE user_id = ?)", claims.ID).
+	if err := dc.DB.Scopes(services.AccessibleDocuments(claims.ID)).
+		Where("title ILIKE ? OR content ILIKE ?", "%"+query+"%", "%"+query+"%").
 		Preload("Tags").
 		Find(&documents).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to search documents"})
@@ -221,6 +756,19 @@ func (dc *DocumentController) SearchDocuments(c echo.Context) error {
 	return c.JSON(http.StatusOK, documents)
 }
 
+// @Summary Загрузить вложение
+// @Description Загружает вложение для указанного документа
+// @Tags document attachments
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Param file formData file true "Файл вложения"
+// @Success 200 {object} models.Attachment
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/attachments [post]
 func (dc *DocumentController) UploadAttachment(c echo.Context) error {
 	documentIDStr := c.Param("id")
 	documentID, err := strconv.ParseUint(documentIDStr, 10, 64)
@@ -293,6 +841,17 @@ func (dc *DocumentController) UploadAttachment(c echo.Context) error {
 	return c.JSON(http.StatusOK, attachment)
 }
 
+// @Summary Получить вложения документа
+// @Description Возвращает список вложений указанного документа
+// @Tags document attachments
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Success 200 {array} models.Attachment
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/attachments [get]
 func (dc *DocumentController) GetAttachments(c echo.Context) error {
 	documentIDStr := c.Param("id")
 	documentID, err := strconv.ParseUint(documentIDStr, 10, 64)
@@ -312,6 +871,17 @@ func (dc *DocumentController) GetAttachments(c echo.Context) error {
 	return c.JSON(http.StatusOK, attachments)
 }
 
+// @Summary Скачать вложение
+// @Tags document attachments
+// @Produce octet-stream
+// @Security BearerAuth
+// @Param path path string true "Путь к файлу вложения"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/download/{path} [get]
 func (dc *DocumentController) DownloadAttachment(c echo.Context) error {
 	encodedPath := c.Param("*")
 	if encodedPath == "" {
@@ -332,6 +902,20 @@ func (dc *DocumentController) DownloadAttachment(c echo.Context) error {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Attachment not found"})
 	}
 
+	var document models.Document
+	if err := dc.DB.First(&document, attachment.DocumentID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Document not found"})
+	}
+
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+	hasAccess, err := services.HasDocumentAccess(dc.DB, &document, claims.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check access rights"})
+	}
+	if !hasAccess {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied"})
+	}
+
 	filePath := filepath.Join("uploads", decodedPath)
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "File not found"})
@@ -340,6 +924,15 @@ func (dc *DocumentController) DownloadAttachment(c echo.Context) error {
 	return c.Attachment(filePath, attachment.Filename)
 }
 
+// @Summary Удалить вложение
+// @Tags document attachments
+// @Security BearerAuth
+// @Param id path int true "ID вложения"
+// @Success 204
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/attachments/{id} [delete]
 func (dc *DocumentController) DeleteAttachment(c echo.Context) error {
 	attachmentID := c.Param("id")
 
@@ -355,7 +948,11 @@ func (dc *DocumentController) DeleteAttachment(c echo.Context) error {
 
 	user := c.Get("user").(*jwt.Token)
 	claims := user.Claims.(*utils.JWTCustomClaims)
-	if document.UserID != claims.ID {
+	isOwner, err := services.HasPermission(dc.DB, &document, claims.ID, models.PermissionOwner)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check access rights"})
+	}
+	if !isOwner {
 		return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied"})
 	}
 
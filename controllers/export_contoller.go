@@ -19,6 +19,16 @@ func NewExportController(exportService *services.ExportService) *ExportControlle
 	return &ExportController{exportService: exportService}
 }
 
+// @Summary Экспортировать документ
+// @Tags documents
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/export [get]
 func (ec *ExportController) ExportDocument(c echo.Context) error {
 	documentIDStr := c.Param("id")
 	documentID, err := strconv.ParseUint(documentIDStr, 10, 64)
@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/services"
 	"github.com/NutsBalls/Nexus/utils"
 	"github.com/golang-jwt/jwt"
 	"github.com/labstack/echo/v4"
@@ -20,9 +21,23 @@ func NewFolderController(db *gorm.DB) *FolderController {
 	return &FolderController{DB: db}
 }
 
+// @Summary Создать папку
+// @Description Создает новую папку для текущего пользователя
+// @Tags Folders
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param folder body models.Folder true "Данные папки"
+// @Success 201 {object} models.Folder
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/folders [post]
 func (fc *FolderController) CreateFolder(c echo.Context) error {
 	type CreateFolderRequest struct {
-		Name string `json:"name" binding:"required"`
+		Name        string `json:"name" binding:"required"`
+		WorkspaceID *uint  `json:"workspace_id,omitempty"`
 	}
 
 	req := new(CreateFolderRequest)
@@ -39,9 +54,20 @@ func (fc *FolderController) CreateFolder(c echo.Context) error {
 		})
 	}
 
+	if req.WorkspaceID != nil {
+		role, err := services.WorkspaceRole(fc.DB, *req.WorkspaceID, claims.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check access rights"})
+		}
+		if !services.WorkspaceRoleAllows(role, models.WorkspaceRoleMember) {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied to workspace"})
+		}
+	}
+
 	folder := &models.Folder{
-		Name:   req.Name,
-		UserID: claims.ID,
+		Name:        req.Name,
+		UserID:      claims.ID,
+		WorkspaceID: req.WorkspaceID,
 	}
 
 	if err := fc.DB.Create(folder).Error; err != nil {
@@ -53,11 +79,38 @@ func (fc *FolderController) CreateFolder(c echo.Context) error {
 	return c.JSON(http.StatusCreated, folder)
 }
 
+// @Summary Получить документы папки
+// @Tags Folders
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID папки"
+// @Success 200 {array} models.Document
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/folders/{id}/documents [get]
 func (dc *DocumentController) GetFolderDocuments(c echo.Context) error {
 	folderID := c.Param("id")
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
+	var folder models.Folder
+	if err := dc.DB.First(&folder, folderID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Folder not found"})
+	}
+
+	permission, err := services.FolderPermission(dc.DB, &folder, claims.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check access rights"})
+	}
+
+	// Без доступа к папке видны только собственные и отдельно расшаренные документы.
+	query := dc.DB.Where("folder_id = ?", folder.ID)
+	if permission == "" {
+		query = query.Scopes(services.AccessibleDocuments(claims.ID))
+	}
 
 	var documents []models.Document
-	if err := dc.DB.Where("folder_id = ?", folderID).Find(&documents).Error; err != nil {
+	if err := query.Find(&documents).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "Failed to fetch documents",
 		})
@@ -66,6 +119,13 @@ func (dc *DocumentController) GetFolderDocuments(c echo.Context) error {
 	return c.JSON(http.StatusOK, documents)
 }
 
+// @Summary Получить список папок
+// @Tags Folders
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Folder
+// @Failure 500 {object} map[string]string
+// @Router /api/folders [get]
 func (fc *FolderController) GetFolders(c echo.Context) error {
 	user := c.Get("user").(*jwt.Token)
 	claims := user.Claims.(*utils.JWTCustomClaims)
@@ -78,6 +138,19 @@ func (fc *FolderController) GetFolders(c echo.Context) error {
 	return c.JSON(http.StatusOK, folders)
 }
 
+// @Summary Обновить папку
+// @Tags Folders
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID папки"
+// @Param folder body models.Folder true "Данные папки"
+// @Success 200 {object} models.Folder
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/folders/{id} [put]
 func (fc *FolderController) UpdateFolder(c echo.Context) error {
 	id := c.Param("id")
 	folder := new(models.Folder)
@@ -86,9 +159,21 @@ func (fc *FolderController) UpdateFolder(c echo.Context) error {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Folder not found"})
 	}
 
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+	permission, err := services.FolderPermission(fc.DB, folder, claims.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check access rights"})
+	}
+	if !services.PermissionAllows(permission, models.PermissionAdmin) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied"})
+	}
+
+	// Владелец и пространство папки через этот метод не меняются.
+	userID, workspaceID := folder.UserID, folder.WorkspaceID
 	if err := c.Bind(folder); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
 	}
+	folder.UserID, folder.WorkspaceID = userID, workspaceID
 
 	if err := fc.DB.Save(folder).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update folder"})
@@ -97,6 +182,15 @@ func (fc *FolderController) UpdateFolder(c echo.Context) error {
 	return c.JSON(http.StatusOK, folder)
 }
 
+// @Summary Удалить папку
+// @Tags Folders
+// @Security BearerAuth
+// @Param id path int true "ID папки"
+// @Success 204
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/folders/{id} [delete]
 func (fc *FolderController) DeleteFolder(c echo.Context) error {
 	log.Printf("DeleteFolder called with context: %v", c.Path())
 
@@ -116,8 +210,13 @@ func (fc *FolderController) DeleteFolder(c echo.Context) error {
 	user := c.Get("user").(*jwt.Token)
 	claims := user.Claims.(*utils.JWTCustomClaims)
 
-	if folder.UserID != claims.ID {
-		log.Printf("Access denied: folder user ID %d doesn't match token user ID %d", folder.UserID, claims.ID)
+	permission, err := services.FolderPermission(fc.DB, &folder, claims.ID)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if permission != models.PermissionOwner {
+		log.Printf("Access denied: user %d is not an owner of folder %d", claims.ID, folder.ID)
 		return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied"})
 	}
 
@@ -18,6 +18,16 @@ func NewImportController(importService *services.ImportService) *ImportControlle
 	return &ImportController{importService: importService}
 }
 
+// @Summary Импортировать документ
+// @Tags documents
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param document formData file true "Файл документа в формате экспорта"
+// @Success 200 {object} models.Document
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/import [post]
 func (ic *ImportController) ImportDocument(c echo.Context) error {
 	user := c.Get("user").(*jwt.Token)
 	claims := user.Claims.(*utils.JWTCustomClaims)
@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/NutsBalls/Nexus/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+type JWKSController struct {
+	Keys *utils.KeySet
+}
+
+func NewJWKSController(keys *utils.KeySet) *JWKSController {
+	return &JWKSController{Keys: keys}
+}
+
+// GetJWKS публикует открытые ключи, которыми другие сервисы проверяют токены Nexus.
+//
+// @Summary Открытые ключи подписи токенов
+// @Tags auth
+// @Produce json
+// @Success 200 {object} utils.JWKSet
+// @Router /.well-known/jwks.json [get]
+func (kc *JWKSController) GetJWKS(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, kc.Keys.JWKS())
+}
@@ -1,10 +1,15 @@
 package controllers
 
 import (
+	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/services"
 	"github.com/NutsBalls/Nexus/utils"
 
 	"github.com/golang-jwt/jwt"
@@ -13,26 +18,33 @@ import (
 )
 
 type NotificationController struct {
-	DB *gorm.DB
+	DB          *gorm.DB
+	Broadcaster services.NotificationBroadcaster
 }
 
-func NewNotificationController(db *gorm.DB) *NotificationController {
-	return &NotificationController{DB: db}
+type notificationResponse struct {
+	models.Notification
+	SenderName string `json:"sender_name"`
 }
 
+func NewNotificationController(db *gorm.DB, broadcaster services.NotificationBroadcaster) *NotificationController {
+	return &NotificationController{DB: db, Broadcaster: broadcaster}
+}
+
+// @Summary Получить уведомления
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} controllers.notificationResponse
+// @Failure 500 {object} map[string]string
+// @Router /api/notifications [get]
 func (nc *NotificationController) GetNotifications(c echo.Context) error {
 	user := c.Get("user").(*jwt.Token)
 	claims := user.Claims.(*utils.JWTCustomClaims)
 
-	var notifications []struct {
-		models.Notification
-		SenderName string `json:"sender_name"`
-	}
+	var notifications []notificationResponse
 
-	if err := nc.DB.Table("notifications").
-		Select("notifications.*, users.username as sender_name").
-		Joins("JOIN users ON users.id = notifications.sender_id").
-		Where("notifications.user_id = ?", claims.ID).
+	if err := nc.notificationsQuery(claims.ID).
 		Order("notifications.created_at DESC").
 		Find(&notifications).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch notifications"})
@@ -41,6 +53,16 @@ func (nc *NotificationController) GetNotifications(c echo.Context) error {
 	return c.JSON(http.StatusOK, notifications)
 }
 
+// @Summary Отметить уведомление прочитанным
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID уведомления"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/notifications/{id}/read [put]
 func (nc *NotificationController) MarkAsRead(c echo.Context) error {
 	notificationIDStr := c.Param("id")
 	notificationID, err := strconv.ParseUint(notificationIDStr, 10, 64)
@@ -66,6 +88,13 @@ func (nc *NotificationController) MarkAsRead(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"message": "Notification marked as read"})
 }
 
+// @Summary Отметить все уведомления прочитанными
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/notifications/read-all [put]
 func (nc *NotificationController) MarkAllAsRead(c echo.Context) error {
 	user := c.Get("user").(*jwt.Token)
 	claims := user.Claims.(*utils.JWTCustomClaims)
@@ -78,3 +107,120 @@ func (nc *NotificationController) MarkAllAsRead(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "All unread notifications marked as read"})
 }
+
+// StreamNotifications отдаёт уведомления как Server-Sent Events. ID события
+// равен ID уведомления, поэтому при переподключении с Last-Event-ID клиент
+// сначала получает всё, что пропустил.
+//
+// @Summary Поток уведомлений
+// @Tags notifications
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Param Last-Event-ID header int false "ID последнего полученного уведомления"
+// @Param ticket query string false "Одноразовый билет вместо заголовка Authorization"
+// @Success 200 {object} controllers.notificationResponse "События text/event-stream"
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/notifications/stream [get]
+func (nc *NotificationController) StreamNotifications(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(*utils.JWTCustomClaims)
+
+	var lastEventID uint64
+	if header := c.Request().Header.Get("Last-Event-ID"); header != "" {
+		id, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid Last-Event-ID"})
+		}
+		lastEventID = id
+	}
+
+	// Подписываемся до чтения пропущенных уведомлений, чтобы ничего не потерять
+	// между запросом к базе и началом трансляции.
+	live, unsubscribe := nc.Broadcaster.Subscribe(claims.ID)
+	defer unsubscribe()
+
+	var missed []notificationResponse
+	if lastEventID > 0 {
+		if err := nc.notificationsQuery(claims.ID).
+			Where("notifications.id > ?", lastEventID).
+			Order("notifications.id ASC").
+			Find(&missed).Error; err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch notifications"})
+		}
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	// ID выдаются раньше, чем фиксируются транзакции, поэтому живое уведомление
+	// может иметь ID меньше уже отправленного. Отбрасываем только те, что были
+	// среди пропущенных.
+	replayed := make(map[uint]struct{}, len(missed))
+	for _, notification := range missed {
+		if err := writeNotificationEvent(res, notification); err != nil {
+			return nil
+		}
+		replayed[notification.ID] = struct{}{}
+	}
+
+	heartbeat := time.NewTicker(30 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(res, ": ping\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case notification, ok := <-live:
+			if !ok {
+				// Отстающий подписчик отключён; клиент переподключится с Last-Event-ID.
+				return nil
+			}
+			if _, ok := replayed[notification.ID]; ok {
+				delete(replayed, notification.ID)
+				continue
+			}
+
+			event := notificationResponse{Notification: notification}
+			var sender models.User
+			if err := nc.DB.Select("username").First(&sender, notification.SenderID).Error; err == nil {
+				event.SenderName = sender.Username
+			}
+
+			if err := writeNotificationEvent(res, event); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+func (nc *NotificationController) notificationsQuery(userID uint) *gorm.DB {
+	return nc.DB.Table("notifications").
+		Select("notifications.*, users.username as sender_name").
+		Joins("JOIN users ON users.id = notifications.sender_id").
+		Where("notifications.user_id = ? AND notifications.deleted_at IS NULL", userID)
+}
+
+func writeNotificationEvent(res *echo.Response, notification notificationResponse) error {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		log.Printf("Failed to encode notification %d: %v", notification.ID, err)
+		return nil
+	}
+
+	if _, err := fmt.Fprintf(res, "id: %d\nevent: notification\ndata: %s\n\n", notification.ID, data); err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
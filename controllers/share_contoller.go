@@ -2,33 +2,56 @@ package controllers
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/services"
 
 	"github.com/NutsBalls/Nexus/utils"
 	"github.com/golang-jwt/jwt"
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ShareController struct {
-	DB *gorm.DB
+	DB                  *gorm.DB
+	NotificationService *services.NotificationService
 }
 
-func NewShareController(db *gorm.DB) *ShareController {
-	return &ShareController{DB: db}
+func NewShareController(db *gorm.DB, notificationService *services.NotificationService) *ShareController {
+	return &ShareController{DB: db, NotificationService: notificationService}
 }
 
+// ShareRequest задаёт получателя доступа: пользователя по email
+// или всех участников рабочего пространства.
+type ShareRequest struct {
+	UserEmail   string                 `json:"user_email"`
+	WorkspaceID *uint                  `json:"workspace_id"`
+	Permission  models.SharePermission `json:"permission"`
+	ExpiresAt   *time.Time             `json:"expires_at"`
+}
+
+// @Summary Предоставить доступ к документу
+// @Description Выдаёт пользователю или рабочему пространству доступ к документу
+// @Tags document sharing
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Param share body controllers.ShareRequest true "Получатель и уровень доступа"
+// @Success 200 {object} models.Share
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/share [post]
 func (sc *ShareController) ShareDocument(c echo.Context) error {
 	documentID := c.Param("id")
 
-	type ShareRequest struct {
-		UserEmail  string                 `json:"user_email"`
-		Permission models.SharePermission `json:"permission"`
-	}
-
 	var req ShareRequest
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
@@ -42,65 +65,251 @@ func (sc *ShareController) ShareDocument(c echo.Context) error {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Document not found"})
 	}
 
-	var existingShare models.Share
-	err := sc.DB.Where("document_id = ? AND user_id = ? AND permission = ?",
-		documentID, claims.ID, models.PermissionAdmin).First(&existingShare).Error
-
-	if err != nil && err != gorm.ErrRecordNotFound {
+	isAdmin, err := services.HasPermission(sc.DB, &document, claims.ID, models.PermissionAdmin)
+	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check access rights"})
 	}
+	if !isAdmin {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied"})
+	}
+
+	share := models.Share{DocumentID: &document.ID}
+	return sc.grantShare(c, claims, req, share, "document_id", document.ID, fmt.Sprintf("\"%s\"", document.Title))
+}
+
+// ShareFolder выдаёт доступ ко всем документам папки, включая те,
+// что будут добавлены в неё позже.
+//
+// @Summary Предоставить доступ к папке
+// @Tags document sharing
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID папки"
+// @Param share body controllers.ShareRequest true "Получатель и уровень доступа"
+// @Success 200 {object} models.Share
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/folders/{id}/share [post]
+func (sc *ShareController) ShareFolder(c echo.Context) error {
+	folderID := c.Param("id")
+
+	var req ShareRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
 
-	isAdmin := err == nil
-	if document.UserID != claims.ID && !isAdmin {
+	var folder models.Folder
+	if err := sc.DB.First(&folder, folderID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Folder not found"})
+	}
+
+	permission, err := services.FolderPermission(sc.DB, &folder, claims.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check access rights"})
+	}
+	if !services.PermissionAllows(permission, models.PermissionAdmin) {
 		return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied"})
 	}
 
-	if req.UserEmail == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "User email cannot be empty"})
+	share := models.Share{FolderID: &folder.ID}
+	return sc.grantShare(c, claims, req, share, "folder_id", folder.ID, fmt.Sprintf("folder \"%s\"", folder.Name))
+}
+
+// grantShare создаёт запись о доступе share к объекту из столбца column
+// с идентификатором targetID и уведомляет получателей.
+func (sc *ShareController) grantShare(c echo.Context, claims *utils.JWTCustomClaims, req ShareRequest, share models.Share, column string, targetID uint, subject string) error {
+	if (req.UserEmail == "") == (req.WorkspaceID == nil) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Either user_email or workspace_id is required"})
+	}
+
+	if !req.Permission.Shareable() {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Permission must be read, write or admin"})
 	}
 
-	var targetUser models.User
-	if err := sc.DB.Where("email = ?", req.UserEmail).First(&targetUser).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
-		}
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to find user"})
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Expiry time must be in the future"})
 	}
 
-	share := models.Share{
-		DocumentID:  document.ID,
-		UserID:      targetUser.ID,
-		Permission:  req.Permission,
-		CreatedByID: claims.ID,
+	var granteeCondition string
+	var granteeID uint
+	var recipients []uint
+	if req.WorkspaceID != nil {
+		var workspace models.Workspace
+		if err := sc.DB.First(&workspace, *req.WorkspaceID).Error; err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Workspace not found"})
+		}
+
+		// Делиться с командой может только её участник.
+		role, err := services.WorkspaceRole(sc.DB, workspace.ID, claims.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check access rights"})
+		}
+		if role == "" {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "You are not a member of this workspace"})
+		}
+
+		// Участники без подтверждённого адреса доступ не получают,
+		// как и при выдаче доступа лично.
+		if recipients, err = services.WorkspaceShareRecipients(sc.DB, workspace.ID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch workspace members"})
+		}
+
+		share.WorkspaceID = &workspace.ID
+		granteeCondition, granteeID = "workspace_id = ?", workspace.ID
+	} else {
+		var targetUser models.User
+		if err := sc.DB.Where("email = ?", req.UserEmail).First(&targetUser).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to find user"})
+		}
+		if !targetUser.EmailVerified() {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "User has not verified their email address"})
+		}
+
+		recipients = []uint{targetUser.ID}
+		share.UserID = &targetUser.ID
+		granteeCondition, granteeID = "user_id = ?", targetUser.ID
 	}
 
-	if err := sc.DB.Where("document_id = ? AND user_id = ?", document.ID, targetUser.ID).First(&models.Share{}).Error; err != nil {
+	share.Permission = req.Permission
+	share.CreatedByID = claims.ID
+	share.ExpiresAt = req.ExpiresAt
+
+	condition := column + " = ? AND " + granteeCondition
+	err := sc.DB.Transaction(func(tx *gorm.DB) error {
+		// Блокируем сам документ или папку, чтобы параллельные запросы
+		// не создали две записи для одного получателя.
+		var target interface{} = &models.Folder{}
+		if share.DocumentID != nil {
+			target = &models.Document{}
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(target, targetID).Error; err != nil {
+			return err
+		}
+
+		var existing models.Share
+		err := tx.Scopes(services.ActiveShares).Where(condition, targetID, granteeID).First(&existing).Error
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			if createErr := sc.DB.Create(&share).Error; createErr != nil {
-				log.Printf("Ошибка при создании share: %v", createErr)
-				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to share document"})
+			// Истёкший доступ, который ещё не удалён фоновой очисткой.
+			if err := tx.Where(condition, targetID, granteeID).Delete(&models.Share{}).Error; err != nil {
+				return err
 			}
-			return c.JSON(http.StatusOK, share)
-		} else {
-			log.Printf("Ошибка при поиске share: %v", err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check existing share"})
+			return tx.Create(&share).Error
 		}
-	} else {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Share already exists for this user and document"})
+		if err != nil {
+			return err
+		}
+
+		// Повторная выдача меняет уровень и срок действующего доступа.
+		existing.Permission = share.Permission
+		existing.ExpiresAt = share.ExpiresAt
+		existing.ExpiryNotifiedAt = nil
+		share = existing
+		return tx.Model(&share).Select("permission", "expires_at", "expiry_notified_at").Updates(&share).Error
+	})
+	if err != nil {
+		log.Printf("Ошибка при сохранении share: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to share"})
 	}
+
+	content := fmt.Sprintf("%s shared %s with you", claims.Username, subject)
+	if share.ExpiresAt != nil {
+		content += fmt.Sprintf(" until %s", share.ExpiresAt.Format("2006-01-02 15:04 MST"))
+	}
+	for _, userID := range recipients {
+		if userID == claims.ID {
+			continue
+		}
+		notification := models.Notification{
+			UserID:   userID,
+			SenderID: claims.ID,
+			Type:     models.NotificationShare,
+			Content:  content,
+			FolderID: share.FolderID,
+		}
+		if share.DocumentID != nil {
+			notification.DocumentID = *share.DocumentID
+		}
+		if err := sc.NotificationService.Send(notification); err != nil {
+			log.Printf("Ошибка при создании уведомления: %v", err)
+		}
+	}
+	return c.JSON(http.StatusOK, share)
 }
 
+// @Summary Получить доступы к документу
+// @Tags document sharing
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Success 200 {array} models.Share
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/shares [get]
 func (sc *ShareController) GetDocumentShares(c echo.Context) error {
 	documentID := c.Param("id")
 
 	var shares []models.Share
-	if err := sc.DB.Preload("User").Where("document_id = ?", documentID).Find(&shares).Error; err != nil {
+	if err := sc.DB.Preload("User").Preload("Workspace").Where("document_id = ?", documentID).Find(&shares).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch shares"})
+	}
+
+	return c.JSON(http.StatusOK, shares)
+}
+
+// @Summary Получить доступы к папке
+// @Tags document sharing
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID папки"
+// @Success 200 {array} models.Share
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/folders/{id}/shares [get]
+func (sc *ShareController) GetFolderShares(c echo.Context) error {
+	folderID := c.Param("id")
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
+	var folder models.Folder
+	if err := sc.DB.First(&folder, folderID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Folder not found"})
+	}
+
+	permission, err := services.FolderPermission(sc.DB, &folder, claims.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check access rights"})
+	}
+	// Список раскрывает, кому открыта папка, поэтому нужен тот же уровень,
+	// что и для управления доступом.
+	if !services.PermissionAllows(permission, models.PermissionAdmin) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied"})
+	}
+
+	var shares []models.Share
+	if err := sc.DB.Preload("User").Preload("Workspace").Where("folder_id = ?", folder.ID).Find(&shares).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch shares"})
 	}
 
 	return c.JSON(http.StatusOK, shares)
 }
 
+// @Summary Отозвать доступ
+// @Tags document sharing
+// @Security BearerAuth
+// @Param id path int true "ID доступа"
+// @Success 204
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/shares/{id} [delete]
 func (sc *ShareController) RemoveShare(c echo.Context) error {
 	shareID := c.Param("id")
 
@@ -112,22 +321,45 @@ func (sc *ShareController) RemoveShare(c echo.Context) error {
 	user := c.Get("user").(*jwt.Token)
 	claims := user.Claims.(*utils.JWTCustomClaims)
 
-	var document models.Document
-	if err := sc.DB.First(&document, share.DocumentID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "Document not found"})
+	var permission models.SharePermission
+	var err error
+	if share.FolderID != nil {
+		var folder models.Folder
+		if err := sc.DB.First(&folder, *share.FolderID).Error; err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Folder not found"})
+		}
+		permission, err = services.FolderPermission(sc.DB, &folder, claims.ID)
+	} else {
+		var document models.Document
+		if err := sc.DB.First(&document, share.DocumentID).Error; err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Document not found"})
+		}
+		permission, err = services.DocumentPermission(sc.DB, &document, claims.ID)
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check access rights"})
 	}
 
-	if document.UserID != claims.ID {
+	// Отзывать доступ может тот же круг, что и выдавать его.
+	if !services.PermissionAllows(permission, models.PermissionAdmin) {
 		return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied"})
 	}
 
-	if err := sc.DB.Where("document_id = ? AND user_id = ?", share.DocumentID, share.UserID).Delete(&models.Share{}).Error; err != nil {
+	if err := sc.DB.Delete(&share).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to remove share"})
 	}
 
 	return c.NoContent(http.StatusNoContent)
 }
 
+// @Summary Документы, доступные мне
+// @Tags document sharing
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Document
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/shares/shared-with-me [get]
 func (sc *ShareController) GetSharedWithMe(c echo.Context) error {
 	userToken, ok := c.Get("user").(*jwt.Token)
 	if !ok || userToken == nil {
@@ -140,11 +372,12 @@ func (sc *ShareController) GetSharedWithMe(c echo.Context) error {
 
 	userID := claims.ID
 	var shares []models.Share
-	if err := sc.DB.Preload("Document").Where("user_id = ?", userID).Find(&shares).Error; err != nil {
+	if err := sc.DB.Preload("Document").Scopes(services.ActiveShares, services.SharesFor(userID)).
+		Where("shares.document_id IS NOT NULL").Find(&shares).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch shared documents"})
 	}
 
-	var sharedDocuments []models.Document
+	sharedDocuments := []models.Document{}
 	for _, share := range shares {
 		sharedDocuments = append(sharedDocuments, share.Document)
 	}
@@ -152,6 +385,46 @@ func (sc *ShareController) GetSharedWithMe(c echo.Context) error {
 	return c.JSON(http.StatusOK, sharedDocuments)
 }
 
+// GetFoldersSharedWithMe возвращает папки, к которым пользователю выдан
+// доступ, вместе с уровнем этого доступа.
+//
+// @Summary Папки, доступные мне
+// @Tags document sharing
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} controllers.sharedFolder
+// @Failure 500 {object} map[string]string
+// @Router /api/shares/shared-with-me/folders [get]
+func (sc *ShareController) GetFoldersSharedWithMe(c echo.Context) error {
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
+	var shares []models.Share
+	if err := sc.DB.Preload("Folder").Scopes(services.ActiveShares, services.SharesFor(claims.ID)).
+		Where("shares.folder_id IS NOT NULL").Find(&shares).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch shared folders"})
+	}
+
+	sharedFolders := []sharedFolder{}
+	for _, share := range shares {
+		sharedFolders = append(sharedFolders, sharedFolder{Folder: share.Folder, Permission: share.Permission})
+	}
+
+	return c.JSON(http.StatusOK, sharedFolders)
+}
+
+type sharedFolder struct {
+	models.Folder
+	Permission models.SharePermission `json:"permission"`
+}
+
+// @Summary Выданные мной доступы
+// @Tags document sharing
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Share
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/shares/shared-by-me [get]
 func (sc *ShareController) GetSharedByMe(c echo.Context) error {
 	userToken, ok := c.Get("user").(*jwt.Token)
 	if !ok || userToken == nil {
@@ -170,6 +443,16 @@ func (sc *ShareController) GetSharedByMe(c echo.Context) error {
 	return c.JSON(http.StatusOK, shares)
 }
 
+// @Summary Проверить доступ к документу
+// @Tags document sharing
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Success 200 {object} map[string]bool
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/shares/{id}/access [get]
 func (sc *ShareController) CheckDocumentAccess(c echo.Context) error {
 	documentID := c.Param("id")
 
@@ -181,12 +464,13 @@ func (sc *ShareController) CheckDocumentAccess(c echo.Context) error {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Document not found"})
 	}
 
-	isOwner := document.UserID == claims.ID
-
-	var share models.Share
-	err := sc.DB.Where("document_id = ? AND user_id = ?", documentID, claims.ID).First(&share).Error
+	permission, err := services.DocumentPermission(sc.DB, &document, claims.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check access rights"})
+	}
 
-	hasAccess := err == nil
+	isOwner := permission == models.PermissionOwner
+	hasAccess := permission != ""
 
 	return c.JSON(http.StatusOK, map[string]bool{
 		"isOwner":   isOwner,
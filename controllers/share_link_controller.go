@@ -0,0 +1,293 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// Заголовок, в котором передаётся пароль защищённой ссылки.
+	linkPasswordHeader = "X-Link-Password"
+	// После стольких неверных паролей подряд ссылка блокируется на linkPasswordLockout.
+	linkPasswordMaxAttempts = 5
+	linkPasswordLockout     = 15 * time.Minute
+)
+
+type ShareLinkController struct {
+	DB *gorm.DB
+}
+
+func NewShareLinkController(db *gorm.DB) *ShareLinkController {
+	return &ShareLinkController{DB: db}
+}
+
+type CreateShareLinkRequest struct {
+	Permission models.SharePermission `json:"permission"`
+	Password   string                 `json:"password"`
+	ExpiresAt  *time.Time             `json:"expires_at"`
+}
+
+type shareLinkResponse struct {
+	models.ShareLink
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// @Summary Создать публичную ссылку
+// @Tags share links
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Param link body controllers.CreateShareLinkRequest true "Параметры ссылки"
+// @Success 201 {object} controllers.shareLinkResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/links [post]
+func (lc *ShareLinkController) CreateShareLink(c echo.Context) error {
+	documentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid document ID"})
+	}
+
+	req := new(CreateShareLinkRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+	}
+
+	if req.Permission == "" {
+		req.Permission = models.PermissionRead
+	}
+	// Посетитель по ссылке не авторизован, поэтому может только читать.
+	if req.Permission != models.PermissionRead {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Links can only grant read access"})
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Expiry time must be in the future"})
+	}
+
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate link"})
+	}
+
+	link := models.ShareLink{
+		DocumentID:  uint(documentID),
+		TokenHash:   utils.HashToken(token),
+		Permission:  req.Permission,
+		ExpiresAt:   req.ExpiresAt,
+		CreatedByID: claims.ID,
+	}
+	if req.Password != "" {
+		if link.PasswordHash, err = utils.HashPassword(req.Password); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to hash password"})
+		}
+		link.HasPassword = true
+	}
+
+	if err := lc.DB.Create(&link).Error; err != nil {
+		log.Printf("Failed to create share link for document %d: %v", documentID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create link"})
+	}
+
+	// Токен показывается только один раз: в базе хранится лишь его хэш.
+	return c.JSON(http.StatusCreated, shareLinkResponse{
+		ShareLink: link,
+		Token:     token,
+		URL:       "/public/" + token,
+	})
+}
+
+// @Summary Получить публичные ссылки документа
+// @Tags share links
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Success 200 {array} models.ShareLink
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/links [get]
+func (lc *ShareLinkController) GetShareLinks(c echo.Context) error {
+	documentID := c.Param("id")
+
+	var links []models.ShareLink
+	if err := lc.DB.Where("document_id = ?", documentID).Order("created_at DESC").Find(&links).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch links"})
+	}
+	for i := range links {
+		links[i].HasPassword = links[i].PasswordHash != ""
+	}
+
+	return c.JSON(http.StatusOK, links)
+}
+
+// @Summary Отозвать публичную ссылку
+// @Tags share links
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Param linkId path int true "ID ссылки"
+// @Success 204
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/links/{linkId} [delete]
+func (lc *ShareLinkController) RevokeShareLink(c echo.Context) error {
+	documentID := c.Param("id")
+	linkID := c.Param("linkId")
+
+	result := lc.DB.Where("id = ? AND document_id = ?", linkID, documentID).Delete(&models.ShareLink{})
+	if result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to revoke link"})
+	}
+	if result.RowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Link not found"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetPublicDocument отдаёт документ по ссылке без авторизации, только для чтения.
+//
+// @Summary Открыть документ по ссылке
+// @Tags share links
+// @Produce json
+// @Param token path string true "Токен ссылки"
+// @Param X-Link-Password header string false "Пароль ссылки"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /public/{token} [get]
+func (lc *ShareLinkController) GetPublicDocument(c echo.Context) error {
+	link, errResponse := lc.resolveLink(c)
+	if errResponse != nil {
+		return errResponse()
+	}
+
+	var attachments []models.Attachment
+	if err := lc.DB.Where("document_id = ?", link.DocumentID).Find(&attachments).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch attachments"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"document":    link.Document,
+		"attachments": attachments,
+		"permission":  link.Permission,
+	})
+}
+
+// @Summary Скачать вложение по ссылке
+// @Tags share links
+// @Produce octet-stream
+// @Param token path string true "Токен ссылки"
+// @Param attachmentId path int true "ID вложения"
+// @Param X-Link-Password header string false "Пароль ссылки"
+// @Success 200 {file} file
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Router /public/{token}/attachments/{attachmentId} [get]
+func (lc *ShareLinkController) DownloadPublicAttachment(c echo.Context) error {
+	link, errResponse := lc.resolveLink(c)
+	if errResponse != nil {
+		return errResponse()
+	}
+
+	var attachment models.Attachment
+	if err := lc.DB.Where("id = ? AND document_id = ?", c.Param("attachmentId"), link.DocumentID).First(&attachment).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Attachment not found"})
+	}
+
+	filePath := filepath.Join("uploads", attachment.Path)
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "File not found"})
+	}
+
+	return c.Attachment(filePath, attachment.Filename)
+}
+
+// resolveLink находит действующую ссылку по токену и проверяет пароль.
+// Истёкшие и отозванные ссылки неотличимы от несуществующих.
+func (lc *ShareLinkController) resolveLink(c echo.Context) (*models.ShareLink, func() error) {
+	c.Response().Header().Set("Cache-Control", "private, no-store")
+	c.Response().Header().Set("X-Robots-Tag", "noindex")
+
+	var link models.ShareLink
+	err := lc.DB.Preload("Document").
+		Where("token_hash = ? AND (expires_at IS NULL OR expires_at > ?)", utils.HashToken(c.Param("token")), time.Now()).
+		First(&link).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, func() error {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Link not found"})
+		}
+	}
+	if err != nil {
+		return nil, func() error {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to open link"})
+		}
+	}
+
+	if link.PasswordHash != "" {
+		if link.LockedUntil != nil && link.LockedUntil.After(time.Now()) {
+			return nil, func() error {
+				return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "Too many password attempts, try again later"})
+			}
+		}
+		password := c.Request().Header.Get(linkPasswordHeader)
+		if password == "" {
+			return nil, func() error {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Password required"})
+			}
+		}
+		if !utils.CheckPasswordHash(password, link.PasswordHash) {
+			if err := lc.recordFailedPassword(link.ID); err != nil {
+				log.Printf("Failed to record password attempt for share link %d: %v", link.ID, err)
+			}
+			return nil, func() error {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid password"})
+			}
+		}
+		if link.FailedAttempts > 0 {
+			if err := lc.DB.Model(&link).Update("failed_attempts", 0).Error; err != nil {
+				log.Printf("Failed to reset password attempts for share link %d: %v", link.ID, err)
+			}
+		}
+	}
+
+	link.HasPassword = link.PasswordHash != ""
+	return &link, nil
+}
+
+// recordFailedPassword засчитывает неверный пароль и после
+// linkPasswordMaxAttempts попыток подряд блокирует ссылку.
+func (lc *ShareLinkController) recordFailedPassword(linkID uint) error {
+	return lc.DB.Transaction(func(tx *gorm.DB) error {
+		var link models.ShareLink
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&link, linkID).Error; err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{"failed_attempts": link.FailedAttempts + 1}
+		if link.FailedAttempts+1 >= linkPasswordMaxAttempts {
+			updates["failed_attempts"] = 0
+			updates["locked_until"] = time.Now().Add(linkPasswordLockout)
+		}
+		return tx.Model(&link).Updates(updates).Error
+	})
+}
@@ -0,0 +1,335 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/services"
+	"github.com/NutsBalls/Nexus/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errSuggestionOutdated = errors.New("suggestion outdated")
+	errSuggestionReviewed = errors.New("suggestion already reviewed")
+)
+
+type SuggestionController struct {
+	DB                  *gorm.DB
+	VersionService      *services.VersionService
+	NotificationService *services.NotificationService
+	MentionService      *services.MentionService
+}
+
+func NewSuggestionController(db *gorm.DB, versionService *services.VersionService, notificationService *services.NotificationService, mentionService *services.MentionService) *SuggestionController {
+	return &SuggestionController{
+		DB:                  db,
+		VersionService:      versionService,
+		NotificationService: notificationService,
+		MentionService:      mentionService,
+	}
+}
+
+type CreateSuggestionRequest struct {
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+	Replacement string `json:"replacement"`
+}
+
+// @Summary Предложить правку
+// @Tags suggestions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Param suggestion body controllers.CreateSuggestionRequest true "Диапазон и замена"
+// @Success 201 {object} models.Suggestion
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/suggestions [post]
+func (sc *SuggestionController) CreateSuggestion(c echo.Context) error {
+	documentID := c.Param("id")
+
+	req := new(CreateSuggestionRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+	}
+
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
+	var document models.Document
+	if err := sc.DB.First(&document, documentID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Document not found"})
+	}
+
+	hasAccess, err := services.HasDocumentAccess(sc.DB, &document, claims.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check access rights"})
+	}
+	if !hasAccess {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied"})
+	}
+
+	if req.Start < 0 || req.Start > req.End || req.End > utils.UTF16Len(document.Content) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid range"})
+	}
+
+	original := utils.SliceUTF16(document.Content, req.Start, req.End)
+	if original == req.Replacement {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Suggestion does not change the document"})
+	}
+
+	suggestion := models.Suggestion{
+		DocumentID:   document.ID,
+		UserID:       claims.ID,
+		RangeStart:   req.Start,
+		RangeEnd:     req.End,
+		OriginalText: original,
+		Replacement:  req.Replacement,
+		Status:       models.SuggestionPending,
+	}
+	if err := sc.DB.Create(&suggestion).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create suggestion"})
+	}
+
+	content := fmt.Sprintf("%s suggested an edit to \"%s\"", claims.Username, document.Title)
+	if err := sc.NotificationService.NotifyEditors(document.ID, claims.ID, models.NotificationSuggestion, content); err != nil {
+		log.Printf("Failed to notify about suggestion %d: %v", suggestion.ID, err)
+	}
+
+	return c.JSON(http.StatusCreated, suggestion)
+}
+
+// @Summary Получить предложения
+// @Tags suggestions
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Param status query string false "Статус, по умолчанию pending"
+// @Success 200 {array} models.Suggestion
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/suggestions [get]
+func (sc *SuggestionController) GetSuggestions(c echo.Context) error {
+	documentID := c.Param("id")
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
+	var document models.Document
+	if err := sc.DB.First(&document, documentID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Document not found"})
+	}
+
+	hasAccess, err := services.HasDocumentAccess(sc.DB, &document, claims.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check access rights"})
+	}
+	if !hasAccess {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied"})
+	}
+
+	status := c.QueryParam("status")
+	if status == "" {
+		status = string(models.SuggestionPending)
+	}
+
+	var suggestions []models.Suggestion
+	if err := sc.DB.Where("document_id = ? AND status = ?", document.ID, status).
+		Order("range_start ASC").
+		Find(&suggestions).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch suggestions"})
+	}
+
+	return c.JSON(http.StatusOK, suggestions)
+}
+
+// AcceptSuggestion применяет предложение к тексту документа и сохраняет
+// прежнее состояние отдельной версией.
+//
+// @Summary Принять предложение
+// @Tags suggestions
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Param suggestionId path int true "ID предложения"
+// @Success 200 {object} models.Suggestion
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/suggestions/{suggestionId}/accept [post]
+func (sc *SuggestionController) AcceptSuggestion(c echo.Context) error {
+	document, suggestion, claims, errResponse := sc.loadForReview(c)
+	if errResponse != nil {
+		return errResponse()
+	}
+
+	var previousContent string
+	err := sc.DB.Transaction(func(tx *gorm.DB) error {
+		var current models.Document
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, document.ID).Error; err != nil {
+			return err
+		}
+		if utils.SliceUTF16(current.Content, suggestion.RangeStart, suggestion.RangeEnd) != suggestion.OriginalText {
+			return errSuggestionOutdated
+		}
+		if err := markSuggestion(tx, suggestion, models.SuggestionAccepted, claims.ID); err != nil {
+			return err
+		}
+
+		changeLog := fmt.Sprintf("accepted suggestion %d", suggestion.ID)
+		if err := sc.VersionService.Record(tx, current, claims.ID, changeLog); err != nil {
+			return err
+		}
+
+		content := utils.SliceUTF16(current.Content, 0, suggestion.RangeStart) +
+			suggestion.Replacement +
+			utils.SliceUTF16(current.Content, suggestion.RangeEnd, utils.UTF16Len(current.Content))
+
+		if err := services.ReanchorDocument(tx, current.ID, current.Content, content); err != nil {
+			return err
+		}
+
+		previousContent = current.Content
+		document.Content = content
+		document.Revision = current.Revision + 1
+		return tx.Model(document).Select("content", "revision", "updated_at").Updates(document).Error
+	})
+	if errors.Is(err, errSuggestionOutdated) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "The suggested text has changed since the suggestion was made"})
+	}
+	if errors.Is(err, errSuggestionReviewed) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Suggestion has already been reviewed"})
+	}
+	if err != nil {
+		log.Printf("Failed to accept suggestion %d: %v", suggestion.ID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to accept suggestion"})
+	}
+
+	if err := sc.MentionService.NotifyNewMentions(document, claims, previousContent, document.Content); err != nil {
+		log.Printf("Failed to notify mentions in document %d: %v", document.ID, err)
+	}
+	sc.notifyAuthor(document, suggestion, claims, "accepted")
+	return c.JSON(http.StatusOK, suggestion)
+}
+
+// @Summary Отклонить предложение
+// @Tags suggestions
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Param suggestionId path int true "ID предложения"
+// @Success 200 {object} models.Suggestion
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/suggestions/{suggestionId}/reject [post]
+func (sc *SuggestionController) RejectSuggestion(c echo.Context) error {
+	document, suggestion, claims, errResponse := sc.loadForReview(c)
+	if errResponse != nil {
+		return errResponse()
+	}
+
+	err := markSuggestion(sc.DB, suggestion, models.SuggestionRejected, claims.ID)
+	if errors.Is(err, errSuggestionReviewed) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Suggestion has already been reviewed"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to reject suggestion"})
+	}
+
+	sc.notifyAuthor(document, suggestion, claims, "rejected")
+	return c.JSON(http.StatusOK, suggestion)
+}
+
+// loadForReview загружает ожидающее предложение и проверяет, что текущий
+// пользователь может редактировать документ.
+func (sc *SuggestionController) loadForReview(c echo.Context) (*models.Document, *models.Suggestion, *utils.JWTCustomClaims, func() error) {
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
+	suggestionID, err := strconv.ParseUint(c.Param("suggestionId"), 10, 64)
+	if err != nil {
+		return nil, nil, nil, func() error {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid suggestion ID"})
+		}
+	}
+
+	var document models.Document
+	if err := sc.DB.First(&document, c.Param("id")).Error; err != nil {
+		return nil, nil, nil, func() error {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Document not found"})
+		}
+	}
+
+	canWrite, err := services.HasWriteAccess(sc.DB, &document, claims.ID)
+	if err != nil {
+		return nil, nil, nil, func() error {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check access rights"})
+		}
+	}
+	if !canWrite {
+		return nil, nil, nil, func() error {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied"})
+		}
+	}
+
+	var suggestion models.Suggestion
+	if err := sc.DB.Where("id = ? AND document_id = ?", suggestionID, document.ID).First(&suggestion).Error; err != nil {
+		return nil, nil, nil, func() error {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Suggestion not found"})
+		}
+	}
+	if suggestion.Status != models.SuggestionPending {
+		return nil, nil, nil, func() error {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Suggestion has already been reviewed"})
+		}
+	}
+
+	return &document, &suggestion, claims, nil
+}
+
+// markSuggestion меняет статус, только если предложение всё ещё ожидает
+// рассмотрения: проверка в loadForReview могла устареть к этому моменту.
+func markSuggestion(db *gorm.DB, suggestion *models.Suggestion, status models.SuggestionStatus, reviewerID uint) error {
+	now := time.Now()
+	result := db.Model(&models.Suggestion{}).
+		Where("id = ? AND status = ?", suggestion.ID, models.SuggestionPending).
+		Updates(map[string]interface{}{
+			"status":         status,
+			"resolved_by_id": reviewerID,
+			"resolved_at":    now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errSuggestionReviewed
+	}
+
+	suggestion.Status = status
+	suggestion.ResolvedByID = &reviewerID
+	suggestion.ResolvedAt = &now
+	return nil
+}
+
+func (sc *SuggestionController) notifyAuthor(document *models.Document, suggestion *models.Suggestion, reviewer *utils.JWTCustomClaims, verb string) {
+	if suggestion.UserID == reviewer.ID {
+		return
+	}
+
+	content := fmt.Sprintf("%s %s your suggestion on \"%s\"", reviewer.Username, verb, document.Title)
+	if err := sc.NotificationService.CreateNotification(suggestion.UserID, reviewer.ID, document.ID, models.NotificationSuggestion, content); err != nil {
+		log.Printf("Failed to notify about suggestion %d: %v", suggestion.ID, err)
+	}
+}
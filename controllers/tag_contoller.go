@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/services"
 	"github.com/NutsBalls/Nexus/utils"
 
 	"github.com/golang-jwt/jwt"
@@ -19,6 +20,16 @@ func NewTagController(db *gorm.DB) *TagController {
 	return &TagController{DB: db}
 }
 
+// @Summary Создать тег
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param tag body models.Tag true "Тег"
+// @Success 201 {object} models.Tag
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/tags [post]
 func (tc *TagController) CreateTag(c echo.Context) error {
 	tag := new(models.Tag)
 	if err := c.Bind(tag); err != nil {
@@ -36,6 +47,13 @@ func (tc *TagController) CreateTag(c echo.Context) error {
 	return c.JSON(http.StatusCreated, tag)
 }
 
+// @Summary Получить теги
+// @Tags tags
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Tag
+// @Failure 500 {object} map[string]string
+// @Router /api/tags [get]
 func (tc *TagController) GetTags(c echo.Context) error {
 	user := c.Get("user").(*jwt.Token)
 	claims := user.Claims.(*utils.JWTCustomClaims)
@@ -48,6 +66,15 @@ func (tc *TagController) GetTags(c echo.Context) error {
 	return c.JSON(http.StatusOK, tags)
 }
 
+// @Summary Найти документы по тегу
+// @Tags tags
+// @Produce json
+// @Security BearerAuth
+// @Param tag query string true "Название тега"
+// @Success 200 {array} models.Document
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/search/tags [get]
 func (tc *TagController) SearchByTag(c echo.Context) error {
 	tagName := c.QueryParam("tag")
 	if tagName == "" {
@@ -60,8 +87,8 @@ func (tc *TagController) SearchByTag(c echo.Context) error {
 	var documents []models.Document
 	if err := tc.DB.Joins("JOIN document_tags ON document_tags.document_id = documents.id").
 		Joins("JOIN tags ON tags.id = document_tags.tag_id").
-		Where("tags.name = ? AND (documents.user_id = ? OR documents.id IN (SELECT document_id FROM document_shares WHERE user_id = ?))",
-			tagName, claims.ID, claims.ID).
+		Where("tags.name = ?", tagName).
+		Scopes(services.AccessibleDocuments(claims.ID)).
 		Preload("Tags").
 		Find(&documents).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to search documents by tag"})
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/NutsBalls/Nexus/services"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+)
+
+type TicketController struct {
+	Tickets *services.TicketStore
+}
+
+func NewTicketController(tickets *services.TicketStore) *TicketController {
+	return &TicketController{Tickets: tickets}
+}
+
+// CreateTicket выдаёт одноразовый билет для подключения к WebSocket или
+// потоку уведомлений: ?ticket=... вместо токена в адресе.
+//
+// @Summary Получить билет для потока
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 201 {object} map[string]interface{}
+// @Failure 500 {object} map[string]string
+// @Router /api/tickets [post]
+func (tc *TicketController) CreateTicket(c echo.Context) error {
+	token := c.Get("user").(*jwt.Token)
+
+	ticket, ttl, err := tc.Tickets.Issue(token)
+	if err != nil {
+		log.Printf("Failed to issue stream ticket: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to issue ticket"})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"ticket":     ticket,
+		"expires_in": int64(ttl / time.Second),
+	})
+}
@@ -0,0 +1,382 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/services"
+	"github.com/NutsBalls/Nexus/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TransferController struct {
+	DB                  *gorm.DB
+	notificationService *services.NotificationService
+}
+
+func NewTransferController(db *gorm.DB, notificationService *services.NotificationService) *TransferController {
+	return &TransferController{DB: db, notificationService: notificationService}
+}
+
+type TransferRequest struct {
+	UserEmail  string `json:"user_email"`
+	KeepAccess bool   `json:"keep_access"`
+}
+
+// TransferDocument предлагает передать документ другому пользователю.
+// Владелец меняется только после того, как получатель примет передачу.
+//
+// @Summary Предложить передачу документа
+// @Tags transfers
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID документа"
+// @Param transfer body controllers.TransferRequest true "Получатель"
+// @Success 201 {object} models.OwnershipTransfer
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/documents/{id}/transfer [post]
+func (tc *TransferController) TransferDocument(c echo.Context) error {
+	var document models.Document
+	if err := tc.DB.First(&document, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Document not found"})
+	}
+
+	transfer := models.OwnershipTransfer{DocumentID: &document.ID, FromUserID: document.UserID}
+	return tc.requestTransfer(c, transfer, "document_id", document.ID, fmt.Sprintf("\"%s\"", document.Title))
+}
+
+// @Summary Предложить передачу папки
+// @Tags transfers
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID папки"
+// @Param transfer body controllers.TransferRequest true "Получатель"
+// @Success 201 {object} models.OwnershipTransfer
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/folders/{id}/transfer [post]
+func (tc *TransferController) TransferFolder(c echo.Context) error {
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
+	var folder models.Folder
+	if err := tc.DB.First(&folder, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Folder not found"})
+	}
+
+	permission, err := services.FolderPermission(tc.DB, &folder, claims.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check access rights"})
+	}
+	if !services.PermissionAllows(permission, models.PermissionOwner) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied"})
+	}
+
+	transfer := models.OwnershipTransfer{FolderID: &folder.ID, FromUserID: folder.UserID}
+	return tc.requestTransfer(c, transfer, "folder_id", folder.ID, fmt.Sprintf("folder \"%s\"", folder.Name))
+}
+
+// requestTransfer создаёт ожидающую передачу объекта из столбца column
+// с идентификатором targetID и уведомляет получателя.
+func (tc *TransferController) requestTransfer(c echo.Context, transfer models.OwnershipTransfer, column string, targetID uint, subject string) error {
+	req := new(TransferRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+	}
+
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
+	// Передать можно только своё: иначе администратор мог бы забрать
+	// чужой документ, назначив получателем себя.
+	if claims.ID != transfer.FromUserID {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Only the owner can transfer ownership"})
+	}
+
+	var recipient models.User
+	if err := tc.DB.Where("email = ?", req.UserEmail).First(&recipient).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to find user"})
+	}
+	if !recipient.EmailVerified() {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "User has not verified their email address"})
+	}
+	if recipient.ID == transfer.FromUserID {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "User already owns this item"})
+	}
+
+	var pending int64
+	if err := tc.DB.Model(&models.OwnershipTransfer{}).
+		Where(column+" = ? AND status = ?", targetID, models.TransferPending).
+		Count(&pending).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check pending transfers"})
+	}
+	if pending > 0 {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "A transfer is already pending for this item"})
+	}
+
+	transfer.ToUserID = recipient.ID
+	transfer.RequestedByID = claims.ID
+	transfer.KeepAccess = req.KeepAccess
+	transfer.Status = models.TransferPending
+
+	err := tc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&transfer).Error; err != nil {
+			return err
+		}
+		return tc.audit(tx, claims.ID, models.AuditTransferRequested, &transfer)
+	})
+	if err != nil {
+		log.Printf("Failed to request transfer of %s %d: %v", column, targetID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to request transfer"})
+	}
+
+	tc.notify(&transfer, recipient.ID, claims.ID,
+		fmt.Sprintf("%s wants to transfer ownership of %s to you", claims.Username, subject))
+
+	return c.JSON(http.StatusCreated, transfer)
+}
+
+// GetTransfers возвращает передачи, в которых участвует пользователь.
+// Параметр status ограничивает выборку одним состоянием.
+//
+// @Summary Получить передачи
+// @Tags transfers
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Статус передачи"
+// @Success 200 {array} models.OwnershipTransfer
+// @Failure 500 {object} map[string]string
+// @Router /api/transfers [get]
+func (tc *TransferController) GetTransfers(c echo.Context) error {
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
+	query := tc.DB.Preload("Document").Preload("Folder").Preload("FromUser").Preload("ToUser").
+		Where("(to_user_id = ? OR from_user_id = ? OR requested_by_id = ?)", claims.ID, claims.ID, claims.ID)
+	if status := c.QueryParam("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var transfers []models.OwnershipTransfer
+	if err := query.Order("created_at DESC").Find(&transfers).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch transfers"})
+	}
+
+	return c.JSON(http.StatusOK, transfers)
+}
+
+// @Summary Принять передачу
+// @Tags transfers
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID передачи"
+// @Success 200 {object} models.OwnershipTransfer
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/transfers/{id}/accept [post]
+func (tc *TransferController) AcceptTransfer(c echo.Context) error {
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
+	var transfer models.OwnershipTransfer
+	var documentIDs []uint
+	status, err := tc.respond(c, &transfer, func(tx *gorm.DB) (int, error) {
+		if transfer.ToUserID != claims.ID {
+			return http.StatusForbidden, errors.New("Access denied")
+		}
+
+		var err error
+		documentIDs, err = services.ApplyOwnershipTransfer(tx, &transfer)
+		if errors.Is(err, services.ErrOwnerChanged) {
+			return http.StatusConflict, errors.New("The item changed owner since the transfer was requested")
+		}
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		return 0, tc.finish(tx, &transfer, models.TransferAccepted, claims.ID, models.AuditTransferAccepted)
+	})
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	content := fmt.Sprintf("%s accepted ownership of %s", claims.Username, tc.subject(&transfer))
+	tc.notifyParties(&transfer, claims.ID, content)
+	log.Printf("Transfer %d accepted, %d documents moved to user %d", transfer.ID, len(documentIDs), transfer.ToUserID)
+
+	return c.JSON(http.StatusOK, transfer)
+}
+
+// @Summary Отклонить передачу
+// @Tags transfers
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID передачи"
+// @Success 200 {object} models.OwnershipTransfer
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/transfers/{id}/decline [post]
+func (tc *TransferController) DeclineTransfer(c echo.Context) error {
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
+	var transfer models.OwnershipTransfer
+	status, err := tc.respond(c, &transfer, func(tx *gorm.DB) (int, error) {
+		if transfer.ToUserID != claims.ID {
+			return http.StatusForbidden, errors.New("Access denied")
+		}
+		return 0, tc.finish(tx, &transfer, models.TransferDeclined, claims.ID, models.AuditTransferDeclined)
+	})
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	content := fmt.Sprintf("%s declined ownership of %s", claims.Username, tc.subject(&transfer))
+	tc.notifyParties(&transfer, claims.ID, content)
+
+	return c.JSON(http.StatusOK, transfer)
+}
+
+// CancelTransfer отзывает передачу. Отменить её может тот, кто её запросил,
+// или текущий владелец.
+//
+// @Summary Отменить передачу
+// @Tags transfers
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID передачи"
+// @Success 200 {object} models.OwnershipTransfer
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/transfers/{id} [delete]
+func (tc *TransferController) CancelTransfer(c echo.Context) error {
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
+	var transfer models.OwnershipTransfer
+	status, err := tc.respond(c, &transfer, func(tx *gorm.DB) (int, error) {
+		if transfer.RequestedByID != claims.ID && transfer.FromUserID != claims.ID {
+			return http.StatusForbidden, errors.New("Access denied")
+		}
+		return 0, tc.finish(tx, &transfer, models.TransferCancelled, claims.ID, models.AuditTransferCancelled)
+	})
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	tc.notify(&transfer, transfer.ToUserID, claims.ID,
+		fmt.Sprintf("%s cancelled the transfer of %s", claims.Username, tc.subject(&transfer)))
+
+	return c.JSON(http.StatusOK, transfer)
+}
+
+// respond блокирует ожидающую передачу и выполняет handle в той же
+// транзакции. Возвращает HTTP-статус и ошибку для ответа клиенту.
+func (tc *TransferController) respond(c echo.Context, transfer *models.OwnershipTransfer, handle func(tx *gorm.DB) (int, error)) (int, error) {
+	status := http.StatusInternalServerError
+	err := tc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(transfer, c.Param("id")).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				status = http.StatusNotFound
+				return errors.New("Transfer not found")
+			}
+			return err
+		}
+		if transfer.Status != models.TransferPending {
+			status = http.StatusConflict
+			return fmt.Errorf("Transfer is already %s", transfer.Status)
+		}
+
+		code, err := handle(tx)
+		if err != nil && code != 0 {
+			status = code
+		}
+		return err
+	})
+	if err != nil && status == http.StatusInternalServerError {
+		log.Printf("Failed to update transfer %s: %v", c.Param("id"), err)
+		err = errors.New("Failed to update transfer")
+	}
+	return status, err
+}
+
+func (tc *TransferController) finish(tx *gorm.DB, transfer *models.OwnershipTransfer, status models.TransferStatus, actorID uint, action models.AuditAction) error {
+	now := time.Now()
+	transfer.Status = status
+	transfer.RespondedAt = &now
+	if err := tx.Model(transfer).Updates(map[string]interface{}{"status": status, "responded_at": now}).Error; err != nil {
+		return err
+	}
+	return tc.audit(tx, actorID, action, transfer)
+}
+
+func (tc *TransferController) audit(tx *gorm.DB, actorID uint, action models.AuditAction, transfer *models.OwnershipTransfer) error {
+	entityType, entityID := services.TransferTarget(transfer)
+	return services.RecordAudit(tx, actorID, action, entityType, entityID, map[string]interface{}{
+		"transfer_id":  transfer.ID,
+		"from_user_id": transfer.FromUserID,
+		"to_user_id":   transfer.ToUserID,
+		"keep_access":  transfer.KeepAccess,
+	})
+}
+
+func (tc *TransferController) subject(transfer *models.OwnershipTransfer) string {
+	if transfer.FolderID != nil {
+		var folder models.Folder
+		if err := tc.DB.First(&folder, *transfer.FolderID).Error; err == nil {
+			return fmt.Sprintf("folder \"%s\"", folder.Name)
+		}
+		return "a folder"
+	}
+	var document models.Document
+	if err := tc.DB.First(&document, *transfer.DocumentID).Error; err == nil {
+		return fmt.Sprintf("\"%s\"", document.Title)
+	}
+	return "a document"
+}
+
+// notifyParties уведомляет прежнего владельца и того, кто запросил передачу.
+func (tc *TransferController) notifyParties(transfer *models.OwnershipTransfer, senderID uint, content string) {
+	tc.notify(transfer, transfer.FromUserID, senderID, content)
+	if transfer.RequestedByID != transfer.FromUserID {
+		tc.notify(transfer, transfer.RequestedByID, senderID, content)
+	}
+}
+
+func (tc *TransferController) notify(transfer *models.OwnershipTransfer, userID, senderID uint, content string) {
+	if userID == senderID {
+		return
+	}
+	notification := models.Notification{
+		UserID:   userID,
+		SenderID: senderID,
+		Type:     models.NotificationTransfer,
+		Content:  content,
+		FolderID: transfer.FolderID,
+	}
+	if transfer.DocumentID != nil {
+		notification.DocumentID = *transfer.DocumentID
+	}
+	if err := tc.notificationService.Send(notification); err != nil {
+		log.Printf("Failed to notify user %d about transfer %d: %v", userID, transfer.ID, err)
+	}
+}
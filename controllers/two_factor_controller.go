@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/services"
+	"github.com/NutsBalls/Nexus/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type TwoFactorController struct {
+	DB               *gorm.DB
+	twoFactorService *services.TwoFactorService
+}
+
+func NewTwoFactorController(db *gorm.DB, twoFactorService *services.TwoFactorService) *TwoFactorController {
+	return &TwoFactorController{DB: db, twoFactorService: twoFactorService}
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// Setup выдаёт новый секрет TOTP и otpauth:// URI для приложения-аутентификатора.
+//
+// @Summary Начать настройку 2FA
+// @Tags two-factor
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/2fa/setup [post]
+func (tfc *TwoFactorController) Setup(c echo.Context) error {
+	user, errResponse := tfc.currentUser(c)
+	if errResponse != nil {
+		return errResponse()
+	}
+
+	secret, uri, err := tfc.twoFactorService.BeginSetup(user)
+	if errors.Is(err, services.ErrTwoFactorEnabled) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Two-factor authentication is already enabled"})
+	}
+	if err != nil {
+		log.Printf("Failed to set up two-factor authentication for user %d: %v", user.ID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to set up two-factor authentication"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"secret":      secret,
+		"otpauth_url": uri,
+	})
+}
+
+// Confirm включает 2FA после проверки первого кода и возвращает коды восстановления.
+//
+// @Summary Включить 2FA
+// @Tags two-factor
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body controllers.TwoFactorCodeRequest true "Код TOTP"
+// @Success 200 {object} map[string][]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/2fa/confirm [post]
+func (tfc *TwoFactorController) Confirm(c echo.Context) error {
+	req := new(TwoFactorCodeRequest)
+	if err := c.Bind(req); err != nil || req.Code == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	user, errResponse := tfc.currentUser(c)
+	if errResponse != nil {
+		return errResponse()
+	}
+
+	codes, err := tfc.twoFactorService.Confirm(user, req.Code)
+	if err != nil {
+		return tfc.errorResponse(c, user, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"recovery_codes": codes})
+}
+
+// @Summary Выпустить новые коды восстановления
+// @Tags two-factor
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body controllers.TwoFactorCodeRequest true "Код TOTP"
+// @Success 200 {object} map[string][]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/2fa/recovery-codes [post]
+func (tfc *TwoFactorController) RegenerateRecoveryCodes(c echo.Context) error {
+	req := new(TwoFactorCodeRequest)
+	if err := c.Bind(req); err != nil || req.Code == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	user, errResponse := tfc.currentUser(c)
+	if errResponse != nil {
+		return errResponse()
+	}
+
+	codes, err := tfc.twoFactorService.RegenerateRecoveryCodes(user, req.Code)
+	if err != nil {
+		return tfc.errorResponse(c, user, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"recovery_codes": codes})
+}
+
+// Disable отключает 2FA. Нужны и пароль, и код, чтобы украденный токен
+// не позволял снять защиту.
+//
+// @Summary Отключить 2FA
+// @Tags two-factor
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body controllers.DisableTwoFactorRequest true "Пароль и код TOTP"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/2fa/disable [post]
+func (tfc *TwoFactorController) Disable(c echo.Context) error {
+	req := new(DisableTwoFactorRequest)
+	if err := c.Bind(req); err != nil || req.Code == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	user, errResponse := tfc.currentUser(c)
+	if errResponse != nil {
+		return errResponse()
+	}
+	if !utils.CheckPasswordHash(req.Password, user.Password) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid password"})
+	}
+
+	if err := tfc.twoFactorService.Disable(user, req.Code); err != nil {
+		return tfc.errorResponse(c, user, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (tfc *TwoFactorController) currentUser(c echo.Context) (*models.User, func() error) {
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
+	var user models.User
+	if err := tfc.DB.First(&user, claims.ID).Error; err != nil {
+		return nil, func() error {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+	}
+	return &user, nil
+}
+
+func (tfc *TwoFactorController) errorResponse(c echo.Context, user *models.User, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidTwoFactorCode):
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid two-factor code"})
+	case errors.Is(err, services.ErrTwoFactorEnabled):
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Two-factor authentication is already enabled"})
+	case errors.Is(err, services.ErrTwoFactorNotEnabled):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Two-factor authentication is not enabled"})
+	case errors.Is(err, services.ErrTwoFactorNotSetUp):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Start two-factor setup first"})
+	case errors.Is(err, services.ErrTwoFactorLocked):
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "Too many invalid two-factor codes, try again later"})
+	}
+	log.Printf("Two-factor operation failed for user %d: %v", user.ID, err)
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update two-factor authentication"})
+}
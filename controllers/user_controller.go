@@ -1,13 +1,15 @@
 package controllers
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/services"
 	"github.com/NutsBalls/Nexus/utils"
 
-	middleware "github.com/NutsBalls/Nexus/middlewares"
-
 	"github.com/golang-jwt/jwt"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/crypto/bcrypt"
@@ -15,14 +17,18 @@ import (
 )
 
 type UserController struct {
-	DB        *gorm.DB
-	JWTSecret string
+	DB               *gorm.DB
+	tokenService     *services.TokenService
+	twoFactorService *services.TwoFactorService
+	accountService   *services.AccountService
 }
 
-func NewUserController(db *gorm.DB, jwtSecret string) *UserController {
+func NewUserController(db *gorm.DB, tokenService *services.TokenService, twoFactorService *services.TwoFactorService, accountService *services.AccountService) *UserController {
 	return &UserController{
-		DB:        db,
-		JWTSecret: jwtSecret,
+		DB:               db,
+		tokenService:     tokenService,
+		twoFactorService: twoFactorService,
+		accountService:   accountService,
 	}
 }
 
@@ -37,15 +43,50 @@ type LoginRequest struct {
 	Password string `json:"password" validate:"required"`
 }
 
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
 type AuthResponse struct {
-	Token string `json:"token"`
-	User  struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	User         struct {
 		ID       uint   `json:"id"`
 		Username string `json:"username"`
 		Email    string `json:"email"`
 	} `json:"user"`
 }
 
+// @Summary Регистрация пользователя
+// @Description Создаёт пользователя и отправляет письмо для подтверждения адреса
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param user body controllers.RegisterRequest true "Данные пользователя"
+// @Success 200 {object} controllers.AuthResponse
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/register [post]
 func (uc *UserController) Register(c echo.Context) error {
 	req := new(RegisterRequest)
 	if err := c.Bind(req); err != nil {
@@ -72,23 +113,26 @@ func (uc *UserController) Register(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create user"})
 	}
 
-	token, err := middleware.GenerateToken(user.ID, user.Username, uc.JWTSecret)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to generate token",
-		})
+	// Письмо можно запросить повторно, поэтому ошибка отправки не мешает регистрации.
+	if err := uc.accountService.SendVerification(&user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
 	}
 
-	return c.JSON(http.StatusOK, map[string]interface{}{
-		"token": token,
-		"user": map[string]interface{}{
-			"id":       user.ID,
-			"username": user.Username,
-			"email":    user.Email,
-		},
-	})
+	return uc.respondWithTokens(c, &user)
 }
 
+// @Summary Вход пользователя
+// @Description Аутентификация пользователя. С включённой 2FA возвращает challenge_token для второго шага
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credentials body controllers.LoginRequest true "Учетные данные"
+// @Success 200 {object} controllers.AuthResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/login [post]
 func (uc *UserController) Login(c echo.Context) error {
 	req := new(LoginRequest)
 	if err := c.Bind(req); err != nil {
@@ -105,7 +149,65 @@ func (uc *UserController) Login(c echo.Context) error {
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid credentials"})
 	}
 
-	token, err := middleware.GenerateToken(user.ID, user.Username, uc.JWTSecret)
+	// С включённой 2FA пароль даёт только токен для второго шага.
+	if user.TOTPEnabled {
+		challenge, ttl, err := uc.twoFactorService.CreateChallenge(&user)
+		if errors.Is(err, services.ErrTwoFactorLocked) {
+			return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "Too many invalid two-factor codes, try again later"})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start two-factor login"})
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+			"expires_in":          int64(ttl / time.Second),
+		})
+	}
+
+	return uc.respondWithTokens(c, &user)
+}
+
+// LoginTwoFactor завершает вход: обменивает токен второго шага и код TOTP
+// или код восстановления на токены доступа.
+//
+// @Summary Второй шаг входа с 2FA
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credentials body controllers.TwoFactorLoginRequest true "Токен второго шага и код"
+// @Success 200 {object} controllers.AuthResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/login/2fa [post]
+func (uc *UserController) LoginTwoFactor(c echo.Context) error {
+	req := new(TwoFactorLoginRequest)
+	if err := c.Bind(req); err != nil || req.ChallengeToken == "" || req.Code == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	user, err := uc.twoFactorService.CompleteChallenge(req.ChallengeToken, req.Code)
+	if errors.Is(err, services.ErrInvalidChallenge) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Login challenge is invalid or expired"})
+	}
+	if errors.Is(err, services.ErrInvalidTwoFactorCode) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid two-factor code"})
+	}
+	if errors.Is(err, services.ErrTwoFactorLocked) {
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "Too many invalid two-factor codes, try again later"})
+	}
+	if err != nil {
+		log.Printf("Failed to complete two-factor login: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to complete login"})
+	}
+
+	return uc.respondWithTokens(c, user)
+}
+
+func (uc *UserController) respondWithTokens(c echo.Context, user *models.User) error {
+	tokens, err := uc.tokenService.IssueTokens(user)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "Failed to generate token",
@@ -113,7 +215,9 @@ func (uc *UserController) Login(c echo.Context) error {
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"token": token,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 		"user": map[string]interface{}{
 			"id":       user.ID,
 			"username": user.Username,
@@ -122,6 +226,197 @@ func (uc *UserController) Login(c echo.Context) error {
 	})
 }
 
+// RefreshToken обменивает refresh-токен на новую пару токенов.
+//
+// @Summary Обновить токены
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token body controllers.RefreshTokenRequest true "Refresh-токен"
+// @Success 200 {object} services.TokenPair
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/token/refresh [post]
+func (uc *UserController) RefreshToken(c echo.Context) error {
+	req := new(RefreshTokenRequest)
+	if err := c.Bind(req); err != nil || req.RefreshToken == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	tokens, err := uc.tokenService.Refresh(req.RefreshToken)
+	if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid refresh token"})
+	}
+	if err != nil {
+		log.Printf("Failed to refresh token: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to refresh token"})
+	}
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Logout отзывает токен текущего запроса. Если передан refresh-токен,
+// отзывается и он, чтобы сеанс нельзя было продлить.
+//
+// @Summary Выход
+// @Tags auth
+// @Accept json
+// @Security BearerAuth
+// @Param token body controllers.LogoutRequest false "Refresh-токен для отзыва"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/logout [post]
+func (uc *UserController) Logout(c echo.Context) error {
+	req := new(LogoutRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+	if err := uc.tokenService.Logout(claims, req.RefreshToken); err != nil {
+		log.Printf("Failed to log out user %d: %v", claims.ID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to log out"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// LogoutEverywhere завершает все сеансы пользователя на всех устройствах.
+//
+// @Summary Выход на всех устройствах
+// @Tags auth
+// @Security BearerAuth
+// @Success 204
+// @Failure 500 {object} map[string]string
+// @Router /api/logout/all [post]
+func (uc *UserController) LogoutEverywhere(c echo.Context) error {
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+	if err := uc.tokenService.LogoutEverywhere(claims.ID); err != nil {
+		log.Printf("Failed to log out user %d everywhere: %v", claims.ID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to log out"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ForgotPassword отправляет ссылку для сброса пароля. Ответ одинаков
+// для зарегистрированных и неизвестных адресов.
+//
+// @Summary Запросить сброс пароля
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body controllers.ForgotPasswordRequest true "Адрес почты"
+// @Success 202 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /api/password/forgot [post]
+func (uc *UserController) ForgotPassword(c echo.Context) error {
+	req := new(ForgotPasswordRequest)
+	if err := c.Bind(req); err != nil || req.Email == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	if err := uc.accountService.RequestPasswordReset(req.Email); err != nil {
+		log.Printf("Failed to send password reset email: %v", err)
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]string{"message": "If the address is registered, a reset link has been sent"})
+}
+
+// @Summary Сбросить пароль
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body controllers.ResetPasswordRequest true "Токен из письма и новый пароль"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/password/reset [post]
+func (uc *UserController) ResetPassword(c echo.Context) error {
+	req := new(ResetPasswordRequest)
+	if err := c.Bind(req); err != nil || req.Token == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	err := uc.accountService.ResetPassword(req.Token, req.Password)
+	if errors.Is(err, services.ErrWeakPassword) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if errors.Is(err, services.ErrInvalidAccountToken) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Reset link is invalid or expired"})
+	}
+	if err != nil {
+		log.Printf("Failed to reset password: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to reset password"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// @Summary Подтвердить адрес почты
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body controllers.VerifyEmailRequest true "Токен из письма"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/email/verify [post]
+func (uc *UserController) VerifyEmail(c echo.Context) error {
+	req := new(VerifyEmailRequest)
+	if err := c.Bind(req); err != nil || req.Token == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	err := uc.accountService.VerifyEmail(req.Token)
+	if errors.Is(err, services.ErrInvalidAccountToken) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Verification link is invalid or expired"})
+	}
+	if err != nil {
+		log.Printf("Failed to verify email: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to verify email"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ResendVerification повторно отправляет письмо для подтверждения адреса.
+//
+// @Summary Повторно отправить письмо с подтверждением
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 202 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/email/verification [post]
+func (uc *UserController) ResendVerification(c echo.Context) error {
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
+	var user models.User
+	if err := uc.DB.First(&user, claims.ID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+	}
+
+	err := uc.accountService.SendVerification(&user)
+	if errors.Is(err, services.ErrEmailAlreadyVerified) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Email is already verified"})
+	}
+	if err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to send verification email"})
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]string{"message": "Verification email sent"})
+}
+
 func (uc *UserController) GetProfile(c echo.Context) error {
 	user := c.Get("user").(*jwt.Token)
 	claims := user.Claims.(*utils.JWTCustomClaims)
@@ -0,0 +1,360 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/services"
+	"github.com/NutsBalls/Nexus/utils"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type WorkspaceController struct {
+	DB *gorm.DB
+}
+
+func NewWorkspaceController(db *gorm.DB) *WorkspaceController {
+	return &WorkspaceController{DB: db}
+}
+
+type WorkspaceRequest struct {
+	Name string `json:"name"`
+}
+
+type WorkspaceMemberRequest struct {
+	UserEmail string               `json:"user_email"`
+	Role      models.WorkspaceRole `json:"role"`
+}
+
+type workspaceResponse struct {
+	models.Workspace
+	Role models.WorkspaceRole `json:"role"`
+}
+
+// @Summary Создать рабочее пространство
+// @Tags workspaces
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param workspace body controllers.WorkspaceRequest true "Название"
+// @Success 201 {object} controllers.workspaceResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/workspaces [post]
+func (wc *WorkspaceController) CreateWorkspace(c echo.Context) error {
+	req := new(WorkspaceRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+	}
+	if req.Name == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Workspace name is required"})
+	}
+
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
+	workspace := models.Workspace{Name: req.Name, CreatedByID: claims.ID}
+	err := wc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&workspace).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.WorkspaceMember{
+			WorkspaceID: workspace.ID,
+			UserID:      claims.ID,
+			Role:        models.WorkspaceRoleOwner,
+		}).Error
+	})
+	if err != nil {
+		log.Printf("Failed to create workspace: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create workspace"})
+	}
+
+	return c.JSON(http.StatusCreated, workspaceResponse{Workspace: workspace, Role: models.WorkspaceRoleOwner})
+}
+
+// @Summary Получить рабочие пространства
+// @Tags workspaces
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} controllers.workspaceResponse
+// @Failure 500 {object} map[string]string
+// @Router /api/workspaces [get]
+func (wc *WorkspaceController) GetWorkspaces(c echo.Context) error {
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
+	var memberships []models.WorkspaceMember
+	if err := wc.DB.Where("user_id = ?", claims.ID).Find(&memberships).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch workspaces"})
+	}
+
+	roles := make(map[uint]models.WorkspaceRole, len(memberships))
+	ids := make([]uint, 0, len(memberships))
+	for _, m := range memberships {
+		roles[m.WorkspaceID] = m.Role
+		ids = append(ids, m.WorkspaceID)
+	}
+
+	var workspaces []models.Workspace
+	if err := wc.DB.Where("id IN ?", ids).Order("name ASC").Find(&workspaces).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch workspaces"})
+	}
+
+	response := make([]workspaceResponse, 0, len(workspaces))
+	for _, w := range workspaces {
+		response = append(response, workspaceResponse{Workspace: w, Role: roles[w.ID]})
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// @Summary Получить рабочее пространство
+// @Tags workspaces
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID рабочего пространства"
+// @Success 200 {object} controllers.workspaceResponse
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/workspaces/{id} [get]
+func (wc *WorkspaceController) GetWorkspace(c echo.Context) error {
+	var workspace models.Workspace
+	if err := wc.DB.Preload("Members.User").First(&workspace, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workspace not found"})
+	}
+
+	role := c.Get("workspaceRole").(models.WorkspaceRole)
+	return c.JSON(http.StatusOK, workspaceResponse{Workspace: workspace, Role: role})
+}
+
+// @Summary Переименовать рабочее пространство
+// @Tags workspaces
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID рабочего пространства"
+// @Param workspace body controllers.WorkspaceRequest true "Название"
+// @Success 200 {object} models.Workspace
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/workspaces/{id} [put]
+func (wc *WorkspaceController) UpdateWorkspace(c echo.Context) error {
+	req := new(WorkspaceRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+	}
+	if req.Name == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Workspace name is required"})
+	}
+
+	var workspace models.Workspace
+	if err := wc.DB.First(&workspace, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workspace not found"})
+	}
+
+	if err := wc.DB.Model(&workspace).Update("name", req.Name).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update workspace"})
+	}
+
+	return c.JSON(http.StatusOK, workspace)
+}
+
+// @Summary Добавить участника
+// @Tags workspaces
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID рабочего пространства"
+// @Param member body controllers.WorkspaceMemberRequest true "Участник и роль"
+// @Success 201 {object} models.WorkspaceMember
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/workspaces/{id}/members [post]
+func (wc *WorkspaceController) AddMember(c echo.Context) error {
+	workspaceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workspace ID"})
+	}
+
+	req := new(WorkspaceMemberRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+	}
+	if req.Role == "" {
+		req.Role = models.WorkspaceRoleMember
+	}
+	if !assignableWorkspaceRole(req.Role) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Role must be admin, member or guest"})
+	}
+
+	var user models.User
+	if err := wc.DB.Where("email = ?", req.UserEmail).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to find user"})
+	}
+	if !user.EmailVerified() {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "User has not verified their email address"})
+	}
+
+	role, err := services.WorkspaceRole(wc.DB, uint(workspaceID), user.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check membership"})
+	}
+	if role != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "User is already a member of this workspace"})
+	}
+
+	member := models.WorkspaceMember{
+		WorkspaceID: uint(workspaceID),
+		UserID:      user.ID,
+		User:        user,
+		Role:        req.Role,
+	}
+	if err := wc.DB.Omit("User").Create(&member).Error; err != nil {
+		log.Printf("Failed to add user %d to workspace %d: %v", user.ID, workspaceID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to add member"})
+	}
+
+	return c.JSON(http.StatusCreated, member)
+}
+
+// @Summary Изменить роль участника
+// @Tags workspaces
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID рабочего пространства"
+// @Param userId path int true "ID пользователя"
+// @Param member body controllers.WorkspaceMemberRequest true "Новая роль"
+// @Success 200 {object} models.WorkspaceMember
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/workspaces/{id}/members/{userId} [put]
+func (wc *WorkspaceController) UpdateMemberRole(c echo.Context) error {
+	req := new(WorkspaceMemberRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+	}
+	if !assignableWorkspaceRole(req.Role) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Role must be admin, member or guest"})
+	}
+
+	member, errResponse := wc.findMember(c)
+	if errResponse != nil {
+		return errResponse()
+	}
+	if member.Role == models.WorkspaceRoleOwner {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "The workspace owner's role cannot be changed"})
+	}
+
+	if err := wc.DB.Model(member).Update("role", req.Role).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update member"})
+	}
+
+	return c.JSON(http.StatusOK, member)
+}
+
+// RemoveMember исключает участника. Администраторы могут исключить любого,
+// кроме владельца, остальные — только выйти сами.
+//
+// @Summary Удалить участника
+// @Tags workspaces
+// @Security BearerAuth
+// @Param id path int true "ID рабочего пространства"
+// @Param userId path int true "ID пользователя"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/workspaces/{id}/members/{userId} [delete]
+func (wc *WorkspaceController) RemoveMember(c echo.Context) error {
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+	role := c.Get("workspaceRole").(models.WorkspaceRole)
+
+	member, errResponse := wc.findMember(c)
+	if errResponse != nil {
+		return errResponse()
+	}
+	if member.Role == models.WorkspaceRoleOwner {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "The workspace owner cannot be removed"})
+	}
+	if member.UserID != claims.ID && !services.WorkspaceRoleAllows(role, models.WorkspaceRoleAdmin) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied"})
+	}
+
+	if err := wc.DB.Delete(member).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to remove member"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// @Summary Получить документы рабочего пространства
+// @Tags workspaces
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID рабочего пространства"
+// @Success 200 {array} models.Document
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/workspaces/{id}/documents [get]
+func (wc *WorkspaceController) GetWorkspaceDocuments(c echo.Context) error {
+	claims := c.Get("claims").(*utils.JWTCustomClaims)
+
+	var documents []models.Document
+	if err := wc.DB.Where("workspace_id = ?", c.Param("id")).
+		Scopes(services.AccessibleDocuments(claims.ID)).
+		Preload("Tags").
+		Find(&documents).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch documents"})
+	}
+
+	return c.JSON(http.StatusOK, documents)
+}
+
+// @Summary Получить папки рабочего пространства
+// @Tags workspaces
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID рабочего пространства"
+// @Success 200 {array} models.Folder
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/workspaces/{id}/folders [get]
+func (wc *WorkspaceController) GetWorkspaceFolders(c echo.Context) error {
+	var folders []models.Folder
+	if err := wc.DB.Where("workspace_id = ?", c.Param("id")).Find(&folders).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch folders"})
+	}
+
+	return c.JSON(http.StatusOK, folders)
+}
+
+func (wc *WorkspaceController) findMember(c echo.Context) (*models.WorkspaceMember, func() error) {
+	var member models.WorkspaceMember
+	if err := wc.DB.Preload("User").
+		Where("workspace_id = ? AND user_id = ?", c.Param("id"), c.Param("userId")).
+		First(&member).Error; err != nil {
+		return nil, func() error {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Member not found"})
+		}
+	}
+	return &member, nil
+}
+
+// Владелец у пространства один и назначается при создании.
+func assignableWorkspaceRole(role models.WorkspaceRole) bool {
+	return role == models.WorkspaceRoleAdmin || role == models.WorkspaceRoleMember || role == models.WorkspaceRoleGuest
+}
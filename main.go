@@ -2,38 +2,32 @@ package main
 
 import (
 	"log"
-	"os"
-	"path/filepath"
 
 	"github.com/NutsBalls/Nexus/config"
 	"github.com/NutsBalls/Nexus/controllers"
 	_ "github.com/NutsBalls/Nexus/docs"
 	"github.com/NutsBalls/Nexus/middlewares"
+	"github.com/NutsBalls/Nexus/models"
 	"github.com/NutsBalls/Nexus/services"
-	"github.com/jinzhu/gorm"
+	"github.com/NutsBalls/Nexus/utils"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	_ "github.com/lib/pq"
+	"gorm.io/gorm"
 )
 
-var db *gorm.DB
-
+// Документация в docs генерируется из аннотаций обработчиков.
+//go:generate go run github.com/swaggo/swag/cmd/swag init --parseDependency
+
+// @title Nexus
+// @version 1.0
+// @description API сервиса совместной работы с документами.
+// @BasePath /
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Токен доступа в формате "Bearer <token>"
 func main() {
-	e := echo.New()
-
-	currentDir, err := os.Getwd()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	e.Use(middleware.Logger())
-	e.Use(middleware.Recover())
-	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"*"},
-		AllowMethods: []string{echo.GET, echo.POST, echo.PUT, echo.DELETE},
-		AllowHeaders: []string{echo.HeaderAuthorization, echo.HeaderContentType},
-	}))
-
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
@@ -44,40 +38,123 @@ func main() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
-	userController := controllers.NewUserController(db, cfg.JWTSecret)
-	documentController := controllers.NewDocumentController(db)
-	shareController := controllers.NewShareController(db)
+	keySet, err := config.LoadKeySet(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+
+	e := newServer(cfg, db, keySet)
+	e.Logger.Fatal(e.Start("0.0.0.0:" + cfg.ServerPort))
+}
+
+// newServer запускает фоновые сервисы и регистрирует все маршруты API.
+func newServer(cfg *config.Config, db *gorm.DB, keySet *utils.KeySet) *echo.Echo {
+	e := echo.New()
+
+	// В логах только путь: query-параметры могут содержать билеты и токены из писем.
+	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
+		Format: `{"time":"${time_rfc3339_nano}","id":"${id}","remote_ip":"${remote_ip}",` +
+			`"host":"${host}","method":"${method}","path":"${path}","user_agent":"${user_agent}",` +
+			`"status":${status},"error":"${error}","latency":${latency},"latency_human":"${latency_human}"` +
+			`,"bytes_in":${bytes_in},"bytes_out":${bytes_out}}` + "\n",
+	}))
+	e.Use(middleware.Recover())
+	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins:  []string{"*"},
+		AllowMethods:  []string{echo.GET, echo.POST, echo.PUT, echo.DELETE},
+		AllowHeaders:  []string{echo.HeaderAuthorization, echo.HeaderContentType, "If-Match", "X-Link-Password"},
+		ExposeHeaders: []string{"ETag"},
+	}))
+
+	versionService := services.NewVersionService(db, cfg.VersionCoalesceWindow)
+	notificationBroadcaster := services.NewInProcessBroadcaster()
+	notificationService := services.NewNotificationService(db, notificationBroadcaster)
+	mentionService := services.NewMentionService(db, notificationService)
+	collabHub := services.NewCollabHub(db, versionService, mentionService, cfg.CollabPersistInterval)
+	shareExpiryService := services.NewShareExpiryService(db, notificationService, cfg.ShareSweepInterval, cfg.ShareExpiryWarning)
+	shareExpiryService.Start()
+
+	ticketStore := services.NewTicketStore()
+	revocationStore := services.NewRevocationStore(db)
+	revocationStore.Start()
+	tokenService := services.NewTokenService(db, revocationStore, keySet, cfg.AccessTokenTTL, cfg.RefreshTokenTTL)
+
+	twoFactorService := services.NewTwoFactorService(db)
+	accountService := services.NewAccountService(db, config.NewMailer(cfg), tokenService, cfg.AppBaseURL)
+
+	userController := controllers.NewUserController(db, tokenService, twoFactorService, accountService)
+	documentController := controllers.NewDocumentController(db, versionService, mentionService)
+	shareController := controllers.NewShareController(db, notificationService)
 
 	e.POST("/api/register", userController.Register)
 	e.POST("/api/login", userController.Login)
+	e.POST("/api/login/2fa", userController.LoginTwoFactor)
+	e.POST("/api/password/forgot", userController.ForgotPassword)
+	e.POST("/api/password/reset", userController.ResetPassword)
+	e.POST("/api/email/verify", userController.VerifyEmail)
+	e.POST("/api/token/refresh", userController.RefreshToken)
+
+	jwksController := controllers.NewJWKSController(keySet)
+	e.GET("/.well-known/jwks.json", jwksController.GetJWKS)
+
+	shareLinkController := controllers.NewShareLinkController(db)
+	e.GET("/public/:token", shareLinkController.GetPublicDocument)
+	e.GET("/public/:token/attachments/:attachmentId", shareLinkController.DownloadPublicAttachment)
 
 	tagController := controllers.NewTagController(db)
 	folderController := controllers.NewFolderController(db)
 
 	api := e.Group("/api")
-	api.Use(middlewares.JWTMiddleware(cfg.JWTSecret))
+	api.Use(middlewares.JWTMiddleware(keySet, revocationStore, ticketStore))
+
+	ticketController := controllers.NewTicketController(ticketStore)
+	api.POST("/tickets", ticketController.CreateTicket)
+
+	api.POST("/logout", userController.Logout)
+	api.POST("/logout/all", userController.LogoutEverywhere)
+	api.POST("/email/verification", userController.ResendVerification)
+
+	twoFactorController := controllers.NewTwoFactorController(db, twoFactorService)
+	api.POST("/2fa/setup", twoFactorController.Setup)
+	api.POST("/2fa/confirm", twoFactorController.Confirm)
+	api.POST("/2fa/recovery-codes", twoFactorController.RegenerateRecoveryCodes)
+	api.POST("/2fa/disable", twoFactorController.Disable)
+
+	// Минимальный уровень доступа к документу для каждого маршрута /documents/:id.
+	canRead := middlewares.DocumentAccessMiddleware(db, models.PermissionRead)
+	canWrite := middlewares.DocumentAccessMiddleware(db, models.PermissionWrite)
+	canAdmin := middlewares.DocumentAccessMiddleware(db, models.PermissionAdmin)
+	isOwner := middlewares.DocumentAccessMiddleware(db, models.PermissionOwner)
 
 	shareGroup := api.Group("/shares")
 
 	api.GET("/shares/shared-with-me", shareController.GetSharedWithMe)
+	api.GET("/shares/shared-with-me/folders", shareController.GetFoldersSharedWithMe)
 	api.GET("/shares/shared-by-me", shareController.GetSharedByMe)
-	shareGroup.GET("/:id/access", shareController.CheckDocumentAccess, middlewares.DocumentAccessMiddleware(db))
+	shareGroup.GET("/:id/access", shareController.CheckDocumentAccess, canRead)
+
+	api.POST("/documents/:id/share", shareController.ShareDocument, canAdmin)
+	api.GET("/documents/:id/shares", shareController.GetDocumentShares, canAdmin)
+	api.DELETE("/shares/:id", shareController.RemoveShare)
 
-	api.POST("/documents/:id/share", shareController.ShareDocument, middlewares.DocumentAccessMiddleware(db))
-	api.GET("/documents/:id/shares", shareController.GetDocumentShares, middlewares.DocumentAccessMiddleware(db))
-	api.DELETE("/shares/:id", shareController.RemoveShare, middlewares.DocumentAccessMiddleware(db))
+	api.POST("/documents/:id/links", shareLinkController.CreateShareLink, canAdmin)
+	api.GET("/documents/:id/links", shareLinkController.GetShareLinks, canAdmin)
+	api.DELETE("/documents/:id/links/:linkId", shareLinkController.RevokeShareLink, canAdmin)
 
 	api.GET("/documents", documentController.GetDocuments)
 	api.POST("/documents", documentController.CreateDocument)
-	api.GET("/documents/:id", documentController.GetDocument)
-	api.PUT("/documents/:id", documentController.UpdateDocument)
+	api.GET("/documents/:id", documentController.GetDocument, canRead)
+	api.PUT("/documents/:id", documentController.UpdateDocument, canWrite)
 	api.DELETE("/attachments/:id", documentController.DeleteAttachment)
-	api.DELETE("/documents/:id", documentController.DeleteDocument)
+	api.DELETE("/documents/:id", documentController.DeleteDocument, isOwner)
 	api.GET("/documents/search", documentController.SearchDocuments)
-	api.POST("/documents/:id/versions", documentController.CreateVersion)
-	api.GET("/documents/:id/versions", documentController.GetVersions)
-	api.POST("/documents/:id/attachments", documentController.UploadAttachment)
-	api.GET("/documents/:id/attachments", documentController.GetAttachments)
+	api.POST("/documents/:id/versions", documentController.CreateVersion, canWrite)
+	api.GET("/documents/:id/versions", documentController.GetVersions, canRead)
+	api.GET("/documents/:id/versions/diff", documentController.DiffVersions, canRead)
+	api.POST("/documents/:id/versions/:versionId/restore", documentController.RestoreVersion, canWrite)
+	api.POST("/documents/:id/merge", documentController.MergeDocument, canWrite)
+	api.POST("/documents/:id/attachments", documentController.UploadAttachment, canWrite)
+	api.GET("/documents/:id/attachments", documentController.GetAttachments, canRead)
 	api.GET("/download/*", documentController.DownloadAttachment)
 
 	api.POST("/folders", folderController.CreateFolder)
@@ -85,42 +162,70 @@ func main() {
 	api.GET("/folders/:id/documents", documentController.GetFolderDocuments)
 	api.PUT("/folders/:id", folderController.UpdateFolder)
 	api.DELETE("/folders/:id", folderController.DeleteFolder)
+	api.POST("/folders/:id/share", shareController.ShareFolder)
+	api.GET("/folders/:id/shares", shareController.GetFolderShares)
+
+	transferController := controllers.NewTransferController(db, notificationService)
+	api.POST("/documents/:id/transfer", transferController.TransferDocument, isOwner)
+	api.POST("/folders/:id/transfer", transferController.TransferFolder)
+	api.GET("/transfers", transferController.GetTransfers)
+	api.POST("/transfers/:id/accept", transferController.AcceptTransfer)
+	api.POST("/transfers/:id/decline", transferController.DeclineTransfer)
+	api.DELETE("/transfers/:id", transferController.CancelTransfer)
+
+	workspaceController := controllers.NewWorkspaceController(db)
+	isWorkspaceGuest := middlewares.WorkspaceAccessMiddleware(db, models.WorkspaceRoleGuest)
+	isWorkspaceMember := middlewares.WorkspaceAccessMiddleware(db, models.WorkspaceRoleMember)
+	isWorkspaceAdmin := middlewares.WorkspaceAccessMiddleware(db, models.WorkspaceRoleAdmin)
+
+	api.POST("/workspaces", workspaceController.CreateWorkspace)
+	api.GET("/workspaces", workspaceController.GetWorkspaces)
+	api.GET("/workspaces/:id", workspaceController.GetWorkspace, isWorkspaceGuest)
+	api.PUT("/workspaces/:id", workspaceController.UpdateWorkspace, isWorkspaceAdmin)
+	api.GET("/workspaces/:id/documents", workspaceController.GetWorkspaceDocuments, isWorkspaceGuest)
+	api.GET("/workspaces/:id/folders", workspaceController.GetWorkspaceFolders, isWorkspaceMember)
+	api.POST("/workspaces/:id/members", workspaceController.AddMember, isWorkspaceAdmin)
+	api.PUT("/workspaces/:id/members/:userId", workspaceController.UpdateMemberRole, isWorkspaceAdmin)
+	api.DELETE("/workspaces/:id/members/:userId", workspaceController.RemoveMember, isWorkspaceGuest)
 
 	api.POST("/tags", tagController.CreateTag)
 	api.GET("/tags", tagController.GetTags)
 
-	api.POST("/documents/:id/attachments", documentController.UploadAttachment)
-	api.GET("/documents/:id/attachments", documentController.GetAttachments)
-
 	exportService := services.NewExportService(db)
 	importService := services.NewImportService(db)
 
 	exportController := controllers.NewExportController(exportService)
 	importController := controllers.NewImportController(importService)
 
-	api.GET("/documents/:id/export", exportController.ExportDocument)
+	api.GET("/documents/:id/export", exportController.ExportDocument, canRead)
 	api.POST("/documents/import", importController.ImportDocument)
 
 	api.GET("/search/tags", tagController.SearchByTag)
 
-	commentController := controllers.NewCommentController(db)
-	notificationController := controllers.NewNotificationController(db)
+	commentController := controllers.NewCommentController(db, notificationService, mentionService)
+	notificationController := controllers.NewNotificationController(db, notificationBroadcaster)
 
-	api.POST("/documents/:id/comments", commentController.AddComment)
-	api.GET("/documents/:id/comments", commentController.GetComments)
-	api.DELETE("/documents/:id/comments/:commentId", commentController.DeleteComment)
+	api.POST("/documents/:id/comments", commentController.AddComment, canRead)
+	api.GET("/documents/:id/comments", commentController.GetComments, canRead)
+	api.DELETE("/documents/:id/comments/:commentId", commentController.DeleteComment, canRead)
+	api.GET("/documents/:id/comments/:commentId/replies", commentController.GetReplies, canRead)
+	api.PUT("/documents/:id/comments/:commentId/resolve", commentController.ResolveThread, canRead)
+	api.PUT("/documents/:id/comments/:commentId/reopen", commentController.ReopenThread, canRead)
 
 	api.GET("/notifications", notificationController.GetNotifications)
+	api.GET("/notifications/stream", notificationController.StreamNotifications)
 	api.PUT("/notifications/:id/read", notificationController.MarkAsRead)
 	api.PUT("/notifications/read-all", notificationController.MarkAllAsRead)
 
-	documentGroup := api.Group("/documents/:id")
-	documentGroup.Use(middlewares.DocumentAccessMiddleware(db))
+	collabController := controllers.NewCollabController(db, collabHub, cfg.AllowedOrigins)
+	api.GET("/documents/:id/collab", collabController.Connect, canRead)
+	api.GET("/documents/:id/presence", collabController.GetPresence, canRead)
 
-	documentGroup.PUT("", documentController.UpdateDocument)
-	documentGroup.DELETE("", documentController.DeleteDocument)
+	suggestionController := controllers.NewSuggestionController(db, versionService, notificationService, mentionService)
+	api.POST("/documents/:id/suggestions", suggestionController.CreateSuggestion, canRead)
+	api.GET("/documents/:id/suggestions", suggestionController.GetSuggestions, canRead)
+	api.POST("/documents/:id/suggestions/:suggestionId/accept", suggestionController.AcceptSuggestion, canWrite)
+	api.POST("/documents/:id/suggestions/:suggestionId/reject", suggestionController.RejectSuggestion, canWrite)
 
-	uploadsDir := filepath.Join(currentDir, "uploads")
-	e.Static("/uploads", uploadsDir)
-	e.Logger.Fatal(e.Start("0.0.0.0:" + cfg.ServerPort))
+	return e
 }
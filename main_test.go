@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NutsBalls/Nexus/config"
+	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/utils"
+	"gorm.io/gorm"
+)
+
+// documentRoutes перечисляет маршруты /documents/:id из newServer и уровень
+// доступа, который каждый из них требует. {id} заменяется идентификатором документа.
+var documentRoutes = []struct {
+	method   string
+	path     string
+	required models.SharePermission
+}{
+	{http.MethodPost, "/api/documents/{id}/share", models.PermissionAdmin},
+	{http.MethodGet, "/api/documents/{id}/shares", models.PermissionAdmin},
+	{http.MethodGet, "/api/shares/{id}/access", models.PermissionRead},
+	{http.MethodPost, "/api/documents/{id}/links", models.PermissionAdmin},
+	{http.MethodGet, "/api/documents/{id}/links", models.PermissionAdmin},
+	{http.MethodDelete, "/api/documents/{id}/links/0", models.PermissionAdmin},
+	{http.MethodGet, "/api/documents/{id}", models.PermissionRead},
+	{http.MethodPut, "/api/documents/{id}", models.PermissionWrite},
+	{http.MethodDelete, "/api/documents/{id}", models.PermissionOwner},
+	{http.MethodPost, "/api/documents/{id}/versions", models.PermissionWrite},
+	{http.MethodGet, "/api/documents/{id}/versions", models.PermissionRead},
+	{http.MethodGet, "/api/documents/{id}/versions/diff", models.PermissionRead},
+	{http.MethodPost, "/api/documents/{id}/versions/0/restore", models.PermissionWrite},
+	{http.MethodPost, "/api/documents/{id}/merge", models.PermissionWrite},
+	{http.MethodPost, "/api/documents/{id}/attachments", models.PermissionWrite},
+	{http.MethodGet, "/api/documents/{id}/attachments", models.PermissionRead},
+	{http.MethodPost, "/api/documents/{id}/transfer", models.PermissionOwner},
+	{http.MethodGet, "/api/documents/{id}/export", models.PermissionRead},
+	{http.MethodPost, "/api/documents/{id}/comments", models.PermissionRead},
+	{http.MethodGet, "/api/documents/{id}/comments", models.PermissionRead},
+	{http.MethodDelete, "/api/documents/{id}/comments/0", models.PermissionRead},
+	{http.MethodGet, "/api/documents/{id}/comments/0/replies", models.PermissionRead},
+	{http.MethodPut, "/api/documents/{id}/comments/0/resolve", models.PermissionRead},
+	{http.MethodPut, "/api/documents/{id}/comments/0/reopen", models.PermissionRead},
+	{http.MethodGet, "/api/documents/{id}/collab", models.PermissionRead},
+	{http.MethodGet, "/api/documents/{id}/presence", models.PermissionRead},
+	{http.MethodPost, "/api/documents/{id}/suggestions", models.PermissionRead},
+	{http.MethodGet, "/api/documents/{id}/suggestions", models.PermissionRead},
+	{http.MethodPost, "/api/documents/{id}/suggestions/0/accept", models.PermissionWrite},
+	{http.MethodPost, "/api/documents/{id}/suggestions/0/reject", models.PermissionWrite},
+}
+
+// Роли перечислены по возрастанию прав: разрушающие запросы (удаление
+// документа) разрешены только последней из них.
+var documentRoles = []struct {
+	name       string
+	permission models.SharePermission
+}{
+	{"none", ""},
+	{"read", models.PermissionRead},
+	{"write", models.PermissionWrite},
+	{"admin", models.PermissionAdmin},
+	{"owner", models.PermissionOwner},
+}
+
+func TestDocumentRoutesAccess(t *testing.T) {
+	db := openTestDB(t)
+	keySet := utils.NewHMACKeySet([]byte("test-secret"))
+	e := newServer(&config.Config{
+		CollabPersistInterval: time.Hour,
+		ShareSweepInterval:    time.Hour,
+		AccessTokenTTL:        time.Hour,
+		RefreshTokenTTL:       2 * time.Hour,
+		MailDriver:            "log",
+	}, db, keySet)
+
+	suffix := time.Now().UnixNano()
+	users := make(map[string]models.User, len(documentRoles))
+	tokens := make(map[string]string, len(documentRoles))
+	for _, role := range documentRoles {
+		user := models.User{
+			Username: fmt.Sprintf("%s-%d", role.name, suffix),
+			Email:    fmt.Sprintf("%s-%d@example.com", role.name, suffix),
+			Password: "-",
+		}
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatalf("create user %s: %v", role.name, err)
+		}
+		token, err := utils.CreateJWTToken(user.ID, user.Username, user.Email, keySet, time.Now().Add(time.Hour).Unix())
+		if err != nil {
+			t.Fatalf("sign token for %s: %v", role.name, err)
+		}
+		users[role.name] = user
+		tokens[role.name] = token
+	}
+
+	for _, route := range documentRoutes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			// У каждого маршрута свой документ, чтобы удаление или правка
+			// в одном случае не влияли на остальные.
+			document := models.Document{Title: "Access test", Content: "text", UserID: users["owner"].ID, Revision: 1}
+			if err := db.Create(&document).Error; err != nil {
+				t.Fatalf("create document: %v", err)
+			}
+			for _, role := range documentRoles {
+				if !role.permission.Shareable() {
+					continue
+				}
+				userID := users[role.name].ID
+				share := models.Share{DocumentID: &document.ID, UserID: &userID, Permission: role.permission, CreatedByID: document.UserID}
+				if err := db.Create(&share).Error; err != nil {
+					t.Fatalf("create %s share: %v", role.name, err)
+				}
+			}
+
+			path := strings.ReplaceAll(route.path, "{id}", fmt.Sprint(document.ID))
+			for _, role := range documentRoles {
+				req := httptest.NewRequest(route.method, path, strings.NewReader("{}"))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer "+tokens[role.name])
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, req)
+
+				allowed := role.permission != "" && permissionRank(role.permission) >= permissionRank(route.required)
+				if denied := accessDenied(rec); denied == allowed {
+					t.Errorf("%s: status %d, body %s; want allowed=%v", role.name, rec.Code, rec.Body.String(), allowed)
+				}
+			}
+		})
+	}
+}
+
+// openTestDB подключается к базе TEST_DB_NAME с параметрами DB_HOST, DB_USER,
+// DB_PASSWORD и DB_PORT. Без TEST_DB_NAME тест пропускается.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	name := os.Getenv("TEST_DB_NAME")
+	if name == "" {
+		t.Skip("TEST_DB_NAME is not set")
+	}
+
+	db, err := config.InitDB(&config.Config{
+		DBHost:     envOr("DB_HOST", "localhost"),
+		DBUser:     envOr("DB_USER", "postgres"),
+		DBPassword: os.Getenv("DB_PASSWORD"),
+		DBName:     name,
+		DBPort:     envOr("DB_PORT", "5432"),
+	})
+	if err != nil {
+		t.Fatalf("connect to test database: %v", err)
+	}
+	return db
+}
+
+func envOr(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func permissionRank(permission models.SharePermission) int {
+	for i, role := range documentRoles {
+		if role.permission == permission {
+			return i
+		}
+	}
+	return -1
+}
+
+// accessDenied сообщает, что запрос отклонила проверка доступа, а не
+// обработчик по другой причине (неверные данные, отсутствующий объект).
+func accessDenied(rec *httptest.ResponseRecorder) bool {
+	if rec.Code != http.StatusForbidden {
+		return false
+	}
+	var body map[string]string
+	return json.Unmarshal(rec.Body.Bytes(), &body) == nil && body["error"] == "Access denied"
+}
@@ -5,13 +5,17 @@ import (
 	"strconv"
 
 	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/services"
 	"github.com/NutsBalls/Nexus/utils"
 	"github.com/golang-jwt/jwt"
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
 )
 
-func DocumentAccessMiddleware(db *gorm.DB) echo.MiddlewareFunc {
+// DocumentAccessMiddleware пропускает запрос к документу из параметра :id,
+// только если у пользователя есть доступ не ниже required. Уровень доступа
+// сохраняется в контексте под ключом "permission".
+func DocumentAccessMiddleware(db *gorm.DB, required models.SharePermission) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			documentIDStr := c.Param("id")
@@ -28,18 +32,17 @@ func DocumentAccessMiddleware(db *gorm.DB) echo.MiddlewareFunc {
 				return c.JSON(http.StatusNotFound, map[string]string{"error": "Document not found"})
 			}
 
-			if document.UserID == claims.ID {
-				return next(c)
+			permission, err := services.DocumentPermission(db, &document, claims.ID)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check access rights"})
 			}
 
-			var share models.Share
-			err = db.Where("document_id = ? AND user_id = ?", documentID, claims.ID).First(&share).Error
-
-			if err == nil {
-				return next(c)
+			if !services.PermissionAllows(permission, required) {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied"})
 			}
 
-			return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied"})
+			c.Set("permission", permission)
+			return next(c)
 		}
 	}
 }
@@ -1,37 +1,59 @@
 package middlewares
 
 import (
+	"log"
 	"net/http"
 	"strings"
 
+	"github.com/NutsBalls/Nexus/services"
 	"github.com/NutsBalls/Nexus/utils"
 	"github.com/golang-jwt/jwt"
 	"github.com/labstack/echo/v4"
 )
 
-func JWTMiddleware(secret string) echo.MiddlewareFunc {
+func JWTMiddleware(keys *utils.KeySet, revocations *services.RevocationStore, tickets *services.TicketStore) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			authHeader := c.Request().Header.Get("Authorization")
-			if authHeader == "" {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Missing authorization token"})
-			}
 
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+			var token *jwt.Token
+			// Браузер не умеет передавать заголовки при открытии WebSocket
+			// и EventSource, поэтому для них принимается одноразовый билет
+			// из query-параметра, выданный по обычному токену.
+			if authHeader == "" && (c.IsWebSocket() || isEventStream(c)) && c.QueryParam("ticket") != "" {
+				var ok bool
+				if token, ok = tickets.Redeem(c.QueryParam("ticket")); !ok {
+					return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid or expired ticket"})
+				}
+			} else {
+				if authHeader == "" {
+					return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Missing authorization token"})
+				}
 
-			token, err := jwt.ParseWithClaims(tokenString, &utils.JWTCustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-				return []byte(secret), nil
-			})
+				tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-			if err != nil {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid token"})
+				var err error
+				token, err = jwt.ParseWithClaims(tokenString, &utils.JWTCustomClaims{}, keys.Keyfunc)
+
+				if err != nil {
+					return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid token"})
+				}
 			}
 
 			claims, ok := token.Claims.(*utils.JWTCustomClaims)
-			if !ok || !token.Valid {
+			if !ok || !token.Valid || claims.Valid() != nil {
 				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid token claims"})
 			}
 
+			revoked, err := revocations.IsRevoked(claims)
+			if err != nil {
+				log.Printf("Failed to check token revocation: %v", err)
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to verify token"})
+			}
+			if revoked {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Token has been revoked"})
+			}
+
 			c.Set("claims", claims)
 			c.Set("user", token)
 
@@ -39,3 +61,7 @@ func JWTMiddleware(secret string) echo.MiddlewareFunc {
 		}
 	}
 }
+
+func isEventStream(c echo.Context) bool {
+	return strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "text/event-stream")
+}
@@ -0,0 +1,45 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/services"
+	"github.com/NutsBalls/Nexus/utils"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// WorkspaceAccessMiddleware пропускает запрос к рабочему пространству из
+// параметра :id, только если роль пользователя в нём не ниже required.
+// Роль сохраняется в контексте под ключом "workspaceRole".
+func WorkspaceAccessMiddleware(db *gorm.DB, required models.WorkspaceRole) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			workspaceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workspace ID"})
+			}
+
+			claims := c.Get("claims").(*utils.JWTCustomClaims)
+
+			var workspace models.Workspace
+			if err := db.First(&workspace, workspaceID).Error; err != nil {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "Workspace not found"})
+			}
+
+			role, err := services.WorkspaceRole(db, workspace.ID, claims.ID)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check access rights"})
+			}
+
+			if !services.WorkspaceRoleAllows(role, required) {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied"})
+			}
+
+			c.Set("workspaceRole", role)
+			return next(c)
+		}
+	}
+}
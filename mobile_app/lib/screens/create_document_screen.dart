@@ -21,7 +21,6 @@ class _CreateDocumentScreenState extends State<CreateDocumentScreen> {
   final _titleController = TextEditingController();
   final _contentController = TextEditingController();
   final ApiService _apiService = ApiService();
-  bool _isPublic = false;
   bool _isLoading = false;
   List<PlatformFile> _pendingFiles = [];
 
@@ -62,7 +61,6 @@ class _CreateDocumentScreenState extends State<CreateDocumentScreen> {
           'title': _titleController.text,
           'content': _contentController.text,
           'folder_id': widget.folderId,
-          'is_public': _isPublic,
         },
         widget.token,
       );
@@ -160,14 +158,6 @@ class _CreateDocumentScreenState extends State<CreateDocumentScreen> {
                       ),
                     ),
                   ],
-                  const SizedBox(height: 16),
-                  SwitchListTile(
-                    title: const Text('Make Public'),
-                    value: _isPublic,
-                    onChanged: (value) {
-                      setState(() => _isPublic = value);
-                    },
-                  ),
                   const SizedBox(height: 20),
                   ElevatedButton(
                     onPressed: _createDocument,
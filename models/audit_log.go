@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+type AuditAction string
+
+const (
+	AuditTransferRequested AuditAction = "ownership_transfer.requested"
+	AuditTransferAccepted  AuditAction = "ownership_transfer.accepted"
+	AuditTransferDeclined  AuditAction = "ownership_transfer.declined"
+	AuditTransferCancelled AuditAction = "ownership_transfer.cancelled"
+)
+
+// AuditLog — неизменяемая запись о значимом действии пользователя.
+type AuditLog struct {
+	ID         uint        `json:"id" gorm:"primaryKey"`
+	ActorID    uint        `json:"actor_id" gorm:"index"`
+	Action     AuditAction `json:"action" gorm:"index;not null"`
+	EntityType string      `json:"entity_type"`
+	EntityID   uint        `json:"entity_id"`
+	Details    string      `json:"details" gorm:"type:jsonb"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -10,4 +12,16 @@ type Comment struct {
 	UserID     uint   `json:"user_id"`
 	Content    string `json:"content"`
 	ParentID   *uint  `json:"parent_id,omitempty"`
+
+	// Привязка к фрагменту текста [AnchorStart, AnchorEnd) в кодовых единицах
+	// UTF-16. Если фрагмент удалён из документа, комментарий помечается Orphaned.
+	AnchorStart *int   `json:"anchor_start,omitempty"`
+	AnchorEnd   *int   `json:"anchor_end,omitempty"`
+	AnchorText  string `json:"anchor_text,omitempty"`
+	Orphaned    bool   `json:"orphaned" gorm:"default:false"`
+
+	// Решённым может быть только корневой комментарий ветки.
+	Resolved     bool       `json:"resolved" gorm:"default:false"`
+	ResolvedByID *uint      `json:"resolved_by_id,omitempty"`
+	ResolvedAt   *time.Time `json:"resolved_at,omitempty"`
 }
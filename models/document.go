@@ -16,11 +16,12 @@ type Document struct {
 	User        User      `gorm:"foreignKey:UserID" json:"-"`
 	FolderID    *uint     `json:"folder_id,omitempty" example:"2"`
 	Folder      Folder    `gorm:"foreignKey:FolderID;constraint:OnDelete:CASCADE;" json:"-"`
+	WorkspaceID *uint     `json:"workspace_id,omitempty" example:"3"`
+	Workspace   Workspace `gorm:"foreignKey:WorkspaceID" json:"-"`
 	Tags        []Tag     `gorm:"many2many:document_tags;" json:"tags"`
-	Versions    []Version `gorm:"foreignKey:DocumentID" json:"versions,omitempty"`
-	SharedUsers []User    `gorm:"many2many:document_shares;" json:"shared_users,omitempty"`
-	IsPublic    bool      `gorm:"default:false" json:"is_public" example:"false"`
+	Versions    []Version `gorm:"foreignKey:DocumentID;constraint:OnDelete:CASCADE;" json:"versions,omitempty"`
 	Shares      []Share   `gorm:"foreignKey:DocumentID" json:"shares"`
+	Revision    uint      `gorm:"not null;default:1" json:"revision" example:"1"`
 }
 
 type Version struct {
@@ -30,7 +31,12 @@ type Version struct {
 	DeletedAt time.Time `gorm:"index" json:"deleted_at,omitempty"`
 
 	DocumentID uint   `json:"document_id"`
+	UserID     uint   `json:"user_id"`
 	Content    string `json:"content"`
 	Title      string `json:"title"`
 	ChangeLog  string `json:"change_log"`
+	// Снимок, созданный автоматически при сохранении. Только в такие версии
+	// объединяются последующие быстрые правки; ручные точки сохранения и
+	// записи об откатах не меняются.
+	Automatic bool `gorm:"not null;default:false" json:"automatic"`
 }
@@ -7,9 +7,12 @@ import (
 type NotificationType string
 
 const (
-	NotificationShare   NotificationType = "share"
-	NotificationComment NotificationType = "comment"
-	NotificationMention NotificationType = "mention"
+	NotificationShare      NotificationType = "share"
+	NotificationComment    NotificationType = "comment"
+	NotificationMention    NotificationType = "mention"
+	NotificationSuggestion NotificationType = "suggestion"
+	NotificationExpiry     NotificationType = "share_expiry"
+	NotificationTransfer   NotificationType = "transfer"
 )
 
 type Notification struct {
@@ -20,4 +23,9 @@ type Notification struct {
 	SenderID   uint             `json:"sender_id"`
 	Content    string           `json:"content"`
 	IsRead     bool             `json:"is_read" gorm:"default:false"`
+	// Для упоминаний: комментарий или позиция в тексте документа (UTF-16).
+	CommentID *uint `json:"comment_id,omitempty"`
+	Offset    *int  `json:"offset,omitempty"`
+	// Для уведомлений о доступе к папке.
+	FolderID *uint `json:"folder_id,omitempty"`
 }
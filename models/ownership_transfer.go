@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+)
+
+type TransferStatus string
+
+const (
+	TransferPending   TransferStatus = "pending"
+	TransferAccepted  TransferStatus = "accepted"
+	TransferDeclined  TransferStatus = "declined"
+	TransferCancelled TransferStatus = "cancelled"
+)
+
+// OwnershipTransfer — предложение передать документ или папку со всеми её
+// документами другому пользователю. Заполнено ровно одно из DocumentID и FolderID.
+type OwnershipTransfer struct {
+	ID            uint           `json:"id" gorm:"primaryKey"`
+	DocumentID    *uint          `json:"document_id,omitempty"`
+	Document      *Document      `json:"document,omitempty" gorm:"foreignKey:DocumentID;constraint:OnDelete:CASCADE;"`
+	FolderID      *uint          `json:"folder_id,omitempty"`
+	Folder        *Folder        `json:"folder,omitempty" gorm:"foreignKey:FolderID;constraint:OnDelete:CASCADE;"`
+	FromUserID    uint           `json:"from_user_id"`
+	FromUser      User           `json:"from_user" gorm:"foreignKey:FromUserID"`
+	ToUserID      uint           `json:"to_user_id"`
+	ToUser        User           `json:"to_user" gorm:"foreignKey:ToUserID"`
+	RequestedByID uint           `json:"requested_by_id"`
+	KeepAccess    bool           `json:"keep_access"`
+	Status        TransferStatus `json:"status" gorm:"default:pending"`
+	RespondedAt   *time.Time     `json:"responded_at,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+}
@@ -10,17 +10,34 @@ const (
 	PermissionRead  SharePermission = "read"
 	PermissionWrite SharePermission = "write"
 	PermissionAdmin SharePermission = "admin"
+	// PermissionOwner не выдаётся через Share: его имеет только автор документа.
+	PermissionOwner SharePermission = "owner"
 )
 
+// Shareable сообщает, можно ли выдать такой уровень доступа другому пользователю.
+func (p SharePermission) Shareable() bool {
+	return p == PermissionRead || p == PermissionWrite || p == PermissionAdmin
+}
+
+// Share выдаёт доступ либо к одному документу, либо ко всем документам
+// папки, включая добавленные позже. Заполнено ровно одно из DocumentID и FolderID.
+// Получатель — пользователь UserID или все участники рабочего пространства WorkspaceID.
 type Share struct {
 	ID          uint            `json:"id" gorm:"primaryKey"`
-	DocumentID  uint            `json:"document_id"`
-	Document    Document        `json:"-" gorm:"foreignKey:DocumentID"`
-	UserID      uint            `json:"user_id"`
-	User        User            `json:"user" gorm:"foreignKey:UserID"`
+	DocumentID  *uint           `json:"document_id,omitempty"`
+	Document    Document        `json:"-" gorm:"foreignKey:DocumentID;constraint:OnDelete:CASCADE;"`
+	FolderID    *uint           `json:"folder_id,omitempty"`
+	Folder      Folder          `json:"-" gorm:"foreignKey:FolderID;constraint:OnDelete:CASCADE;"`
+	UserID      *uint           `json:"user_id,omitempty"`
+	User        *User           `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	WorkspaceID *uint           `json:"workspace_id,omitempty"`
+	Workspace   *Workspace      `json:"workspace,omitempty" gorm:"foreignKey:WorkspaceID"`
 	Permission  SharePermission `json:"permission"`
 	CreatedAt   time.Time       `json:"created_at"`
 	UpdatedAt   time.Time       `json:"updated_at"`
 	CreatedByID uint            `json:"created_by_id"`
 	CreatedBy   User            `json:"created_by" gorm:"foreignKey:CreatedByID"`
+	ExpiresAt   *time.Time      `json:"expires_at,omitempty"`
+	// Когда участников предупредили о скором истечении доступа.
+	ExpiryNotifiedAt *time.Time `json:"-"`
 }
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// ShareLink даёт доступ к документу на чтение без учётной записи по секретной
+// ссылке. Сам токен не хранится, только его хэш.
+type ShareLink struct {
+	ID           uint            `json:"id" gorm:"primaryKey"`
+	DocumentID   uint            `json:"document_id"`
+	Document     Document        `json:"-" gorm:"foreignKey:DocumentID;constraint:OnDelete:CASCADE;"`
+	TokenHash    string          `json:"-" gorm:"uniqueIndex;not null"`
+	Permission   SharePermission `json:"permission"`
+	PasswordHash string          `json:"-"`
+	HasPassword  bool            `json:"has_password" gorm:"-"`
+	// Неверные пароли подряд; после нескольких ссылка временно блокируется.
+	FailedAttempts int        `json:"-" gorm:"not null;default:0"`
+	LockedUntil    *time.Time `json:"-"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	CreatedByID    uint       `json:"created_by_id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
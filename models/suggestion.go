@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type SuggestionStatus string
+
+const (
+	SuggestionPending  SuggestionStatus = "pending"
+	SuggestionAccepted SuggestionStatus = "accepted"
+	SuggestionRejected SuggestionStatus = "rejected"
+)
+
+// Suggestion — предложенная замена фрагмента [RangeStart, RangeEnd) текста
+// документа на Replacement. Смещения в кодовых единицах UTF-16.
+type Suggestion struct {
+	gorm.Model
+	DocumentID   uint             `json:"document_id"`
+	UserID       uint             `json:"user_id"`
+	RangeStart   int              `json:"start"`
+	RangeEnd     int              `json:"end"`
+	OriginalText string           `json:"original_text"`
+	Replacement  string           `json:"replacement"`
+	Status       SuggestionStatus `json:"status" gorm:"default:pending"`
+	ResolvedByID *uint            `json:"resolved_by_id,omitempty"`
+	ResolvedAt   *time.Time       `json:"resolved_at,omitempty"`
+}
@@ -10,9 +10,33 @@ type User struct {
 	UpdatedAt time.Time `json:"updated_at"`
 	DeletedAt time.Time `gorm:"index" json:"deleted_at,omitempty"`
 
-	Username  string     `gorm:"uniqueIndex;not null" json:"username" example:"johndoe"`
-	Email     string     `gorm:"uniqueIndex;not null" json:"email" example:"john@example.com"`
-	Password  string     `gorm:"not null" json:"-"`
-	Documents []Document `gorm:"foreignKey:UserID" json:"documents,omitempty"`
-	Folders   []Folder   `gorm:"foreignKey:UserID" json:"folders,omitempty"`
+	Username string `gorm:"uniqueIndex;not null" json:"username" example:"johndoe"`
+	Email    string `gorm:"uniqueIndex;not null" json:"email" example:"john@example.com"`
+	Password string `gorm:"not null" json:"-"`
+	// Пока адрес не подтверждён, аккаунт ограничен: например, ему нельзя
+	// выдать доступ к документу.
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	// Access-токены, выпущенные не позже этого момента, отозваны
+	// («выйти на всех устройствах»).
+	TokensRevokedAt *time.Time `json:"-"`
+	// Секрет TOTP сохраняется при настройке, но вход с кодом требуется
+	// только после подтверждения (TOTPEnabled).
+	TOTPSecret   string `json:"-"`
+	TOTPEnabled  bool   `gorm:"default:false" json:"totp_enabled"`
+	TOTPLastStep int64  `json:"-"`
+	// Неверные коды второго шага подряд, по всем попыткам входа. После
+	// нескольких второй шаг блокируется до TOTPLockedUntil.
+	TOTPFailedAttempts int        `gorm:"not null;default:0" json:"-"`
+	TOTPLockedUntil    *time.Time `json:"-"`
+	Documents          []Document `gorm:"foreignKey:UserID" json:"documents,omitempty"`
+	Folders            []Folder   `gorm:"foreignKey:UserID" json:"folders,omitempty"`
+}
+
+// TwoFactorLocked сообщает, заблокирован ли второй шаг входа из-за неверных кодов.
+func (u *User) TwoFactorLocked(now time.Time) bool {
+	return u.TOTPLockedUntil != nil && u.TOTPLockedUntil.After(now)
+}
+
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
 }
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+type UserTokenPurpose string
+
+const (
+	TokenPasswordReset     UserTokenPurpose = "password_reset"
+	TokenEmailVerification UserTokenPurpose = "email_verification"
+)
+
+// UserToken — одноразовый токен из письма: сброс пароля или подтверждение
+// адреса. Хранится только хэш.
+type UserToken struct {
+	ID        uint             `json:"id" gorm:"primaryKey"`
+	UserID    uint             `json:"user_id" gorm:"index;not null"`
+	User      User             `json:"-" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;"`
+	Purpose   UserTokenPurpose `json:"purpose" gorm:"index;not null"`
+	TokenHash string           `json:"-" gorm:"uniqueIndex;not null"`
+	// Адрес, который подтверждается: если пользователь сменит email,
+	// старая ссылка перестанет подходить.
+	Email     string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
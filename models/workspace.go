@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+)
+
+type WorkspaceRole string
+
+const (
+	WorkspaceRoleOwner  WorkspaceRole = "owner"
+	WorkspaceRoleAdmin  WorkspaceRole = "admin"
+	WorkspaceRoleMember WorkspaceRole = "member"
+	WorkspaceRoleGuest  WorkspaceRole = "guest"
+)
+
+// Workspace — команда, которой могут принадлежать папки и документы.
+type Workspace struct {
+	ID          uint              `json:"id" gorm:"primaryKey"`
+	Name        string            `json:"name" gorm:"not null"`
+	CreatedByID uint              `json:"created_by_id"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	Members     []WorkspaceMember `json:"members,omitempty" gorm:"foreignKey:WorkspaceID;constraint:OnDelete:CASCADE;"`
+}
+
+type WorkspaceMember struct {
+	ID          uint          `json:"id" gorm:"primaryKey"`
+	WorkspaceID uint          `json:"workspace_id" gorm:"uniqueIndex:idx_workspace_member"`
+	UserID      uint          `json:"user_id" gorm:"uniqueIndex:idx_workspace_member"`
+	User        User          `json:"user" gorm:"foreignKey:UserID"`
+	Role        WorkspaceRole `json:"role" gorm:"not null"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
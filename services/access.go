@@ -0,0 +1,262 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/NutsBalls/Nexus/models"
+
+	"gorm.io/gorm"
+)
+
+// permissionRanks упорядочивает уровни доступа: каждый следующий включает
+// права всех предыдущих.
+var permissionRanks = map[models.SharePermission]int{
+	models.PermissionRead:  1,
+	models.PermissionWrite: 2,
+	models.PermissionAdmin: 3,
+	models.PermissionOwner: 4,
+}
+
+// PermissionAllows сообщает, достаточно ли уровня granted для действия,
+// требующего уровня required.
+func PermissionAllows(granted, required models.SharePermission) bool {
+	rank, ok := permissionRanks[granted]
+	return ok && rank >= permissionRanks[required]
+}
+
+// DocumentPermission возвращает уровень доступа пользователя к документу
+// или пустую строку, если доступа нет. Из доступа к самому документу, к его
+// папке и через рабочее пространство выбирается больший.
+func DocumentPermission(db *gorm.DB, document *models.Document, userID uint) (models.SharePermission, error) {
+	if document.UserID == userID {
+		return models.PermissionOwner, nil
+	}
+
+	permission, err := workspacePermission(db, document.WorkspaceID, userID)
+	if err != nil {
+		return "", err
+	}
+
+	var shares []models.Share
+	if err := db.Scopes(ActiveShares, DocumentShares(document), SharesFor(userID)).Find(&shares).Error; err != nil {
+		return "", err
+	}
+	return strongestPermission(permission, shares), nil
+}
+
+// FolderPermission возвращает уровень доступа пользователя к папке.
+func FolderPermission(db *gorm.DB, folder *models.Folder, userID uint) (models.SharePermission, error) {
+	if folder.UserID == userID {
+		return models.PermissionOwner, nil
+	}
+
+	permission, err := workspacePermission(db, folder.WorkspaceID, userID)
+	if err != nil {
+		return "", err
+	}
+
+	var shares []models.Share
+	if err := db.Scopes(ActiveShares, SharesFor(userID)).Where("shares.folder_id = ?", folder.ID).Find(&shares).Error; err != nil {
+		return "", err
+	}
+	return strongestPermission(permission, shares), nil
+}
+
+func strongestPermission(strongest models.SharePermission, shares []models.Share) models.SharePermission {
+	for _, share := range shares {
+		// Владелец определяется только документом, не записью о доступе.
+		if share.Permission.Shareable() && permissionRanks[share.Permission] > permissionRanks[strongest] {
+			strongest = share.Permission
+		}
+	}
+	return strongest
+}
+
+func HasPermission(db *gorm.DB, document *models.Document, userID uint, required models.SharePermission) (bool, error) {
+	permission, err := DocumentPermission(db, document, userID)
+	if err != nil {
+		return false, err
+	}
+	return PermissionAllows(permission, required), nil
+}
+
+func HasDocumentAccess(db *gorm.DB, document *models.Document, userID uint) (bool, error) {
+	return HasPermission(db, document, userID, models.PermissionRead)
+}
+
+func HasWriteAccess(db *gorm.DB, document *models.Document, userID uint) (bool, error) {
+	return HasPermission(db, document, userID, models.PermissionWrite)
+}
+
+// ActiveShares отбрасывает записи о доступе, срок действия которых истёк.
+func ActiveShares(db *gorm.DB) *gorm.DB {
+	return db.Where("(shares.expires_at IS NULL OR shares.expires_at > ?)", time.Now())
+}
+
+// DocumentShares выбирает записи о доступе к документу и к его папке.
+func DocumentShares(document *models.Document) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if document.FolderID == nil {
+			return db.Where("shares.document_id = ?", document.ID)
+		}
+		return db.Where("(shares.document_id = ? OR shares.folder_id = ?)", document.ID, *document.FolderID)
+	}
+}
+
+// SharesFor выбирает записи о доступе, выданные пользователю лично или
+// рабочим пространствам, в которых он состоит. Доступ пространства, как и
+// личный, получают только участники с подтверждённым адресом.
+func SharesFor(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		workspaces := verifiedMembers(db).
+			Select("workspace_members.workspace_id").
+			Where("workspace_members.user_id = ?", userID)
+		return db.Where("(shares.user_id = ? OR shares.workspace_id IN (?))", userID, workspaces)
+	}
+}
+
+// AccessibleDocuments ограничивает выборку документов теми, которые
+// принадлежат пользователю или его рабочим пространствам либо расшарены
+// с ним напрямую или через папку.
+func AccessibleDocuments(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		shares := func(column string) *gorm.DB {
+			return db.Session(&gorm.Session{NewDB: true}).
+				Model(&models.Share{}).
+				Scopes(ActiveShares, SharesFor(userID)).
+				Select(column).
+				Where(column + " IS NOT NULL")
+		}
+		// Гости видят в пространстве только то, что им явно расшарили.
+		workspaces := memberWorkspaces(db, userID).Where("role <> ?", models.WorkspaceRoleGuest)
+		return db.Where("(documents.user_id = ? OR documents.id IN (?) OR documents.folder_id IN (?) OR documents.workspace_id IN (?))",
+			userID, shares("document_id"), shares("folder_id"), workspaces)
+	}
+}
+
+// DocumentAudience возвращает пользователей, у которых есть доступ к документу
+// не ниже required.
+func DocumentAudience(db *gorm.DB, document *models.Document, required models.SharePermission) ([]uint, error) {
+	audience := map[uint]bool{document.UserID: true}
+
+	if document.WorkspaceID != nil {
+		var members []models.WorkspaceMember
+		if err := db.Where("workspace_id = ?", *document.WorkspaceID).Find(&members).Error; err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			if PermissionAllows(workspaceRolePermissions[member.Role], required) {
+				audience[member.UserID] = true
+			}
+		}
+	}
+
+	var shares []models.Share
+	if err := db.Scopes(ActiveShares, DocumentShares(document)).Find(&shares).Error; err != nil {
+		return nil, err
+	}
+
+	var teamIDs []uint
+	for _, share := range shares {
+		if !share.Permission.Shareable() || !PermissionAllows(share.Permission, required) {
+			continue
+		}
+		if share.UserID != nil {
+			audience[*share.UserID] = true
+		}
+		if share.WorkspaceID != nil {
+			teamIDs = append(teamIDs, *share.WorkspaceID)
+		}
+	}
+
+	if len(teamIDs) > 0 {
+		memberIDs, err := WorkspaceShareRecipients(db, teamIDs...)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range memberIDs {
+			audience[id] = true
+		}
+	}
+
+	userIDs := make([]uint, 0, len(audience))
+	for id := range audience {
+		userIDs = append(userIDs, id)
+	}
+	return userIDs, nil
+}
+
+var workspaceRoleRanks = map[models.WorkspaceRole]int{
+	models.WorkspaceRoleGuest:  1,
+	models.WorkspaceRoleMember: 2,
+	models.WorkspaceRoleAdmin:  3,
+	models.WorkspaceRoleOwner:  4,
+}
+
+// workspaceRolePermissions задаёт доступ участника к документам и папкам
+// пространства. Гости получают доступ только через явные записи в shares.
+// Права владельца (удаление, перенос, передача) пространство не даёт: они
+// есть только у автора документа или папки.
+var workspaceRolePermissions = map[models.WorkspaceRole]models.SharePermission{
+	models.WorkspaceRoleOwner:  models.PermissionAdmin,
+	models.WorkspaceRoleAdmin:  models.PermissionAdmin,
+	models.WorkspaceRoleMember: models.PermissionWrite,
+}
+
+func WorkspaceRoleAllows(granted, required models.WorkspaceRole) bool {
+	rank, ok := workspaceRoleRanks[granted]
+	return ok && rank >= workspaceRoleRanks[required]
+}
+
+// WorkspaceRole возвращает роль пользователя в рабочем пространстве или
+// пустую строку, если он в нём не состоит.
+func WorkspaceRole(db *gorm.DB, workspaceID, userID uint) (models.WorkspaceRole, error) {
+	var member models.WorkspaceMember
+	err := db.Where("workspace_id = ? AND user_id = ?", workspaceID, userID).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return member.Role, nil
+}
+
+func workspacePermission(db *gorm.DB, workspaceID *uint, userID uint) (models.SharePermission, error) {
+	if workspaceID == nil {
+		return "", nil
+	}
+	role, err := WorkspaceRole(db, *workspaceID, userID)
+	if err != nil {
+		return "", err
+	}
+	return workspaceRolePermissions[role], nil
+}
+
+// WorkspaceShareRecipients возвращает участников пространств, которым достаётся
+// доступ, выданный этим пространствам.
+func WorkspaceShareRecipients(db *gorm.DB, workspaceIDs ...uint) ([]uint, error) {
+	var userIDs []uint
+	err := verifiedMembers(db).
+		Where("workspace_members.workspace_id IN ?", workspaceIDs).
+		Distinct().
+		Pluck("workspace_members.user_id", &userIDs).Error
+	return userIDs, err
+}
+
+// verifiedMembers выбирает членства пользователей с подтверждённым адресом:
+// в пространство можно попасть и без подтверждения, например создав его.
+func verifiedMembers(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).
+		Model(&models.WorkspaceMember{}).
+		Joins("JOIN users ON users.id = workspace_members.user_id").
+		Where("users.email_verified_at IS NOT NULL")
+}
+
+func memberWorkspaces(db *gorm.DB, userID uint) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).
+		Model(&models.WorkspaceMember{}).
+		Select("workspace_id").
+		Where("user_id = ?", userID)
+}
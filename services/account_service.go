@@ -0,0 +1,193 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 48 * time.Hour
+	// Не чаще одного письма каждого вида в этот интервал.
+	accountMailCooldown = time.Minute
+	minPasswordLength   = 6
+)
+
+var (
+	ErrInvalidAccountToken  = errors.New("invalid or expired token")
+	ErrWeakPassword         = fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	ErrEmailAlreadyVerified = errors.New("email is already verified")
+)
+
+// AccountService отвечает за письма со ссылками для подтверждения адреса
+// и сброса пароля.
+type AccountService struct {
+	db           *gorm.DB
+	mailer       Mailer
+	tokenService *TokenService
+	baseURL      string
+}
+
+func NewAccountService(db *gorm.DB, mailer Mailer, tokenService *TokenService, baseURL string) *AccountService {
+	return &AccountService{db: db, mailer: mailer, tokenService: tokenService, baseURL: baseURL}
+}
+
+// SendVerification отправляет ссылку для подтверждения адреса.
+func (s *AccountService) SendVerification(user *models.User) error {
+	if user.EmailVerified() {
+		return ErrEmailAlreadyVerified
+	}
+
+	token, err := s.issue(user, models.TokenEmailVerification, emailVerificationTTL)
+	if err != nil || token == "" {
+		return err
+	}
+
+	link := s.link("/verify-email", token)
+	body := fmt.Sprintf("Hello, %s!\n\nConfirm your email address for Nexus by opening this link:\n\n%s\n\nThe link is valid for %s.\n",
+		user.Username, link, emailVerificationTTL)
+	return s.mailer.Send(user.Email, "Confirm your email address", body)
+}
+
+// VerifyEmail подтверждает адрес по токену из письма.
+func (s *AccountService) VerifyEmail(token string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		record, err := s.consume(tx, token, models.TokenEmailVerification)
+		if err != nil {
+			return err
+		}
+		if record.Email != record.User.Email {
+			return ErrInvalidAccountToken
+		}
+		return tx.Model(&record.User).Update("email_verified_at", time.Now()).Error
+	})
+}
+
+// RequestPasswordReset отправляет ссылку для сброса пароля. Если такого
+// адреса нет, ничего не происходит: ответ не должен выдавать,
+// зарегистрирован ли адрес.
+func (s *AccountService) RequestPasswordReset(email string) error {
+	var user models.User
+	err := s.db.Where("email = ?", strings.TrimSpace(email)).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := s.issue(&user, models.TokenPasswordReset, passwordResetTTL)
+	if err != nil || token == "" {
+		return err
+	}
+
+	link := s.link("/reset-password", token)
+	body := fmt.Sprintf("Hello, %s!\n\nSomeone requested a password reset for your Nexus account. To choose a new password, open this link:\n\n%s\n\nThe link is valid for %s. If you did not request a reset, ignore this email.\n",
+		user.Username, link, passwordResetTTL)
+	return s.mailer.Send(user.Email, "Reset your password", body)
+}
+
+// ResetPassword задаёт новый пароль по токену из письма и завершает все
+// сеансы пользователя. Письмо доказывает владение адресом, поэтому
+// адрес заодно считается подтверждённым.
+func (s *AccountService) ResetPassword(token, password string) error {
+	if len(password) < minPasswordLength {
+		return ErrWeakPassword
+	}
+
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	var userID uint
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		record, err := s.consume(tx, token, models.TokenPasswordReset)
+		if err != nil {
+			return err
+		}
+		userID = record.UserID
+
+		updates := map[string]interface{}{"password": hash}
+		if !record.User.EmailVerified() && record.Email == record.User.Email {
+			updates["email_verified_at"] = time.Now()
+		}
+		if err := tx.Model(&record.User).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		// Остальные ссылки для сброса больше не нужны.
+		return tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, models.TokenPasswordReset).
+			Update("used_at", time.Now()).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.tokenService.LogoutEverywhere(userID)
+}
+
+// issue создаёт токен и возвращает его. Пустая строка без ошибки означает,
+// что похожее письмо уже недавно отправлялось.
+func (s *AccountService) issue(user *models.User, purpose models.UserTokenPurpose, ttl time.Duration) (string, error) {
+	var recent int64
+	if err := s.db.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND created_at > ?", user.ID, purpose, time.Now().Add(-accountMailCooldown)).
+		Count(&recent).Error; err != nil {
+		return "", err
+	}
+	if recent > 0 {
+		log.Printf("Письмо %s для пользователя %d уже отправлялось недавно", purpose, user.ID)
+		return "", nil
+	}
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	if err := s.db.Create(&models.UserToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: utils.HashToken(token),
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(ttl),
+	}).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consume находит действующий токен и помечает его использованным.
+func (s *AccountService) consume(tx *gorm.DB, token string, purpose models.UserTokenPurpose) (*models.UserToken, error) {
+	var record models.UserToken
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("User").
+		Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", utils.HashToken(token), purpose, time.Now()).
+		First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidAccountToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Model(&record).Update("used_at", time.Now()).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (s *AccountService) link(path, token string) string {
+	return s.baseURL + path + "?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/utils"
+
+	"gorm.io/gorm"
+)
+
+// ReanchorDocument переносит привязки комментариев и ожидающих предложений
+// на новый текст документа. Вызывается в той же транзакции, что и сохранение
+// содержимого.
+func ReanchorDocument(tx *gorm.DB, documentID uint, oldContent, newContent string) error {
+	if oldContent == newContent {
+		return nil
+	}
+
+	operation := utils.DiffOperation(oldContent, newContent)
+	if err := reanchorComments(tx, documentID, operation, newContent); err != nil {
+		return err
+	}
+	return reanchorSuggestions(tx, documentID, operation)
+}
+
+func reanchorComments(tx *gorm.DB, documentID uint, operation utils.TextOperation, newContent string) error {
+	var comments []models.Comment
+	if err := tx.Where("document_id = ? AND anchor_start IS NOT NULL AND anchor_end IS NOT NULL AND orphaned = ?", documentID, false).
+		Find(&comments).Error; err != nil {
+		return err
+	}
+
+	for _, comment := range comments {
+		start, end := operation.TransformRange(*comment.AnchorStart, *comment.AnchorEnd)
+
+		updates := map[string]interface{}{
+			"anchor_start": start,
+			"anchor_end":   end,
+		}
+		if start == end {
+			// Текст удалён целиком: оставляем исходную цитату, чтобы было видно,
+			// к чему относился комментарий.
+			updates["orphaned"] = true
+		} else {
+			updates["anchor_text"] = utils.SliceUTF16(newContent, start, end)
+		}
+
+		if err := tx.Model(&comment).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reanchorSuggestions сдвигает диапазоны предложений. Исходный текст не
+// меняется: если его отредактировали, предложение больше нельзя принять.
+func reanchorSuggestions(tx *gorm.DB, documentID uint, operation utils.TextOperation) error {
+	var suggestions []models.Suggestion
+	if err := tx.Where("document_id = ? AND status = ?", documentID, models.SuggestionPending).
+		Find(&suggestions).Error; err != nil {
+		return err
+	}
+
+	for _, suggestion := range suggestions {
+		start, end := operation.TransformRange(suggestion.RangeStart, suggestion.RangeEnd)
+		if err := tx.Model(&suggestion).Updates(map[string]interface{}{
+			"range_start": start,
+			"range_end":   end,
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,26 @@
+package services
+
+import (
+	"encoding/json"
+
+	"github.com/NutsBalls/Nexus/models"
+
+	"gorm.io/gorm"
+)
+
+// RecordAudit добавляет запись в журнал аудита. Вызывается внутри той же
+// транзакции, что и само действие, чтобы запись не расходилась с данными.
+func RecordAudit(db *gorm.DB, actorID uint, action models.AuditAction, entityType string, entityID uint, details interface{}) error {
+	payload, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	return db.Create(&models.AuditLog{
+		ActorID:    actorID,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Details:    string(payload),
+	}).Error
+}
@@ -0,0 +1,573 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	CollabMessageInit      = "init"
+	CollabMessageOperation = "operation"
+	CollabMessageAck       = "ack"
+	CollabMessageError     = "error"
+	CollabMessageJoin      = "join"
+	CollabMessageLeave     = "leave"
+	CollabMessageCursor    = "cursor"
+	CollabMessageAccess    = "access"
+)
+
+type CollabMessage struct {
+	Type         string              `json:"type"`
+	Revision     int                 `json:"revision"`
+	Operation    utils.TextOperation `json:"operation,omitempty"`
+	Content      string              `json:"content,omitempty"`
+	UserID       uint                `json:"user_id,omitempty"`
+	ClientID     uint64              `json:"client_id,omitempty"`
+	CanWrite     bool                `json:"can_write,omitempty"`
+	Presence     *Presence           `json:"presence,omitempty"`
+	Participants []Presence          `json:"participants,omitempty"`
+	Error        string              `json:"error,omitempty"`
+}
+
+// Cursor — выделение в документе в кодовых единицах UTF-16;
+// при Anchor == Head это просто позиция курсора.
+type Cursor struct {
+	Anchor int `json:"anchor"`
+	Head   int `json:"head"`
+}
+
+type Presence struct {
+	ClientID uint64    `json:"client_id"`
+	UserID   uint      `json:"user_id"`
+	Username string    `json:"username"`
+	Cursor   *Cursor   `json:"cursor,omitempty"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type CollabClient struct {
+	UserID   uint
+	Username string
+	// CanWrite после Join меняется только под мьютексом сессии.
+	CanWrite bool
+	Send     chan CollabMessage
+
+	// Поля ниже защищены мьютексом сессии.
+	id       uint64
+	session  *collabSession
+	closed   bool
+	cursor   *Cursor
+	joinedAt time.Time
+}
+
+func NewCollabClient(userID uint, username string, canWrite bool) *CollabClient {
+	return &CollabClient{
+		UserID:   userID,
+		Username: username,
+		CanWrite: canWrite,
+		Send:     make(chan CollabMessage, 64),
+	}
+}
+
+func (cl *CollabClient) presence() Presence {
+	p := Presence{
+		ClientID: cl.id,
+		UserID:   cl.UserID,
+		Username: cl.Username,
+		JoinedAt: cl.joinedAt,
+	}
+	if cl.cursor != nil {
+		cursor := *cl.cursor
+		p.Cursor = &cursor
+	}
+	return p
+}
+
+func (cl *CollabClient) close() {
+	if !cl.closed {
+		cl.closed = true
+		close(cl.Send)
+	}
+}
+
+// send не блокируется: клиента, который не успевает читать, отключаем.
+func (cl *CollabClient) send(msg CollabMessage) {
+	if cl.closed {
+		return
+	}
+	select {
+	case cl.Send <- msg:
+	default:
+		log.Printf("Collab client of user %d is too slow, disconnecting", cl.UserID)
+		cl.close()
+	}
+}
+
+// collabSession хранит состояние совместного редактирования одного документа.
+// Ревизии OT считаются от открытия сессии и не совпадают с Document.Revision.
+type collabSession struct {
+	mu         sync.Mutex
+	documentID uint
+	content    string
+	history    []utils.TextOperation
+	clients    map[*CollabClient]struct{}
+	lastEditor uint
+	// Имя последнего автора правки — от его лица отправляются уведомления
+	// об упоминаниях.
+	lastEditorName string
+
+	// Состояние документа в базе на момент последнего сохранения и операции,
+	// применённые поверх него с тех пор: persistedContent + pending = content.
+	persistedContent string
+	pending          []utils.TextOperation
+	documentRevision uint
+
+	// persistMu не даёт двум сохранениям идти одновременно. Запись в базу
+	// идёт без session.mu, чтобы медленная база не останавливала правки.
+	persistMu sync.Mutex
+
+	closed          bool
+	stopPersistLoop chan struct{}
+	// Закрывается, когда закрытая сессия сохранена и удалена из хаба.
+	done chan struct{}
+}
+
+type CollabHub struct {
+	db              *gorm.DB
+	versionService  *VersionService
+	mentionService  *MentionService
+	persistInterval time.Duration
+
+	mu           sync.Mutex
+	sessions     map[uint]*collabSession
+	nextClientID uint64
+}
+
+func NewCollabHub(db *gorm.DB, versionService *VersionService, mentionService *MentionService, persistInterval time.Duration) *CollabHub {
+	return &CollabHub{
+		db:              db,
+		versionService:  versionService,
+		mentionService:  mentionService,
+		persistInterval: persistInterval,
+		sessions:        make(map[uint]*collabSession),
+	}
+}
+
+func (h *CollabHub) Join(documentID uint, client *CollabClient) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	session, ok := h.sessions[documentID]
+	// Последний участник только что ушёл, и сессия ещё сохраняется:
+	// новая сессия должна прочитать из базы уже сохранённое содержимое.
+	for ok && session.closed {
+		h.mu.Unlock()
+		<-session.done
+		h.mu.Lock()
+		session, ok = h.sessions[documentID]
+	}
+	if !ok {
+		var document models.Document
+		if err := h.db.First(&document, documentID).Error; err != nil {
+			return err
+		}
+
+		session = &collabSession{
+			documentID:       documentID,
+			content:          document.Content,
+			clients:          make(map[*CollabClient]struct{}),
+			persistedContent: document.Content,
+			documentRevision: document.Revision,
+			stopPersistLoop:  make(chan struct{}),
+			done:             make(chan struct{}),
+		}
+		h.sessions[documentID] = session
+		go h.persistLoop(session)
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	h.nextClientID++
+	client.id = h.nextClientID
+	client.joinedAt = time.Now()
+	client.session = session
+
+	participants := session.participants()
+	session.clients[client] = struct{}{}
+
+	self := client.presence()
+	client.send(CollabMessage{
+		Type:         CollabMessageInit,
+		Revision:     len(session.history),
+		Content:      session.content,
+		ClientID:     client.id,
+		CanWrite:     client.CanWrite,
+		Participants: participants,
+	})
+	session.broadcast(client, CollabMessage{
+		Type:     CollabMessageJoin,
+		Revision: len(session.history),
+		Presence: &self,
+	})
+	return nil
+}
+
+// Presence возвращает участников, у которых документ сейчас открыт.
+func (h *CollabHub) Presence(documentID uint) []Presence {
+	h.mu.Lock()
+	session, ok := h.sessions[documentID]
+	h.mu.Unlock()
+	if !ok {
+		return []Presence{}
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.participants()
+}
+
+func (h *CollabHub) Leave(client *CollabClient) {
+	session := client.session
+	if session == nil {
+		return
+	}
+
+	h.mu.Lock()
+	session.mu.Lock()
+
+	delete(session.clients, client)
+	client.close()
+
+	if len(session.clients) > 0 {
+		session.broadcast(nil, CollabMessage{
+			Type:     CollabMessageLeave,
+			Revision: len(session.history),
+			UserID:   client.UserID,
+			ClientID: client.id,
+		})
+		session.mu.Unlock()
+		h.mu.Unlock()
+		return
+	}
+
+	// Последний клиент ушёл. Сессия остаётся в хабе закрытой, пока
+	// документ не сохранён: Join дождётся этого через session.done.
+	session.closed = true
+	close(session.stopPersistLoop)
+	session.mu.Unlock()
+	h.mu.Unlock()
+
+	if err := h.persist(session); err != nil {
+		log.Printf("Failed to persist collaborative session for document %d: %v", session.documentID, err)
+	}
+
+	h.mu.Lock()
+	delete(h.sessions, session.documentID)
+	close(session.done)
+	h.mu.Unlock()
+}
+
+// Submit применяет операцию клиента, построенную поверх ревизии revision.
+func (h *CollabHub) Submit(client *CollabClient, revision int, operation utils.TextOperation) {
+	session := client.session
+	if session == nil {
+		return
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if !client.CanWrite {
+		client.send(CollabMessage{Type: CollabMessageError, Error: "Write access required"})
+		return
+	}
+
+	if revision < 0 || revision > len(session.history) {
+		client.send(CollabMessage{Type: CollabMessageError, Error: "Invalid revision"})
+		return
+	}
+
+	var err error
+	for _, concurrent := range session.history[revision:] {
+		if operation, _, err = utils.TransformOperations(operation, concurrent); err != nil {
+			client.send(CollabMessage{Type: CollabMessageError, Error: "Operation does not match document"})
+			return
+		}
+	}
+
+	content, err := operation.Apply(session.content)
+	if err != nil {
+		client.send(CollabMessage{Type: CollabMessageError, Error: "Operation does not match document"})
+		return
+	}
+
+	session.apply(content, operation)
+	session.lastEditor = client.UserID
+	session.lastEditorName = client.Username
+
+	client.send(CollabMessage{Type: CollabMessageAck, Revision: len(session.history)})
+	session.broadcast(client, CollabMessage{
+		Type:      CollabMessageOperation,
+		Revision:  len(session.history),
+		Operation: operation,
+		UserID:    client.UserID,
+		ClientID:  client.id,
+	})
+}
+
+// MoveCursor обновляет выделение клиента, заданное на ревизии revision.
+func (h *CollabHub) MoveCursor(client *CollabClient, revision int, cursor Cursor) {
+	session := client.session
+	if session == nil {
+		return
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if revision < 0 || revision > len(session.history) {
+		client.send(CollabMessage{Type: CollabMessageError, Error: "Invalid revision"})
+		return
+	}
+
+	for _, op := range session.history[revision:] {
+		cursor.Anchor = op.TransformIndex(cursor.Anchor)
+		cursor.Head = op.TransformIndex(cursor.Head)
+	}
+	client.cursor = &cursor
+
+	presence := client.presence()
+	session.broadcast(client, CollabMessage{
+		Type:     CollabMessageCursor,
+		Revision: len(session.history),
+		Presence: &presence,
+	})
+}
+
+// apply фиксирует применённую операцию и сдвигает сохранённые курсоры.
+func (s *collabSession) apply(content string, operation utils.TextOperation) {
+	s.content = content
+	s.history = append(s.history, operation)
+	s.pending = append(s.pending, operation)
+
+	for client := range s.clients {
+		if client.cursor != nil {
+			client.cursor.Anchor = operation.TransformIndex(client.cursor.Anchor)
+			client.cursor.Head = operation.TransformIndex(client.cursor.Head)
+		}
+	}
+}
+
+func (s *collabSession) participants() []Presence {
+	participants := make([]Presence, 0, len(s.clients))
+	for client := range s.clients {
+		participants = append(participants, client.presence())
+	}
+	sort.Slice(participants, func(i, j int) bool {
+		return participants[i].ClientID < participants[j].ClientID
+	})
+	return participants
+}
+
+func (s *collabSession) broadcast(sender *CollabClient, msg CollabMessage) {
+	for client := range s.clients {
+		if client != sender {
+			client.send(msg)
+		}
+	}
+}
+
+func (h *CollabHub) persistLoop(session *collabSession) {
+	ticker := time.NewTicker(h.persistInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := h.refreshAccess(session); err != nil {
+				log.Printf("Failed to refresh access for collaborative session of document %d: %v", session.documentID, err)
+			}
+			if err := h.persist(session); err != nil {
+				log.Printf("Failed to persist collaborative session for document %d: %v", session.documentID, err)
+			}
+		case <-session.stopPersistLoop:
+			return
+		}
+	}
+}
+
+// refreshAccess перепроверяет права участников сессии, чтобы отзыв доступа,
+// истечение срока или понижение до чтения действовали и на открытые соединения.
+// Клиент без доступа отключается, а при смене права на запись получает сообщение access.
+func (h *CollabHub) refreshAccess(session *collabSession) error {
+	var document models.Document
+	if err := h.db.First(&document, session.documentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	session.mu.Lock()
+	clients := make([]*CollabClient, 0, len(session.clients))
+	for client := range session.clients {
+		clients = append(clients, client)
+	}
+	session.mu.Unlock()
+
+	permissions := make(map[uint]models.SharePermission, len(clients))
+	for _, client := range clients {
+		if _, ok := permissions[client.UserID]; ok {
+			continue
+		}
+		permission, err := DocumentPermission(h.db, &document, client.UserID)
+		if err != nil {
+			return err
+		}
+		permissions[client.UserID] = permission
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	for _, client := range clients {
+		if _, ok := session.clients[client]; !ok {
+			continue
+		}
+		permission := permissions[client.UserID]
+		if !PermissionAllows(permission, models.PermissionRead) {
+			client.send(CollabMessage{Type: CollabMessageError, Error: "Access denied"})
+			// Сокет закроется, и обработчик соединения вызовет Leave.
+			client.close()
+			continue
+		}
+		if canWrite := PermissionAllows(permission, models.PermissionWrite); canWrite != client.CanWrite {
+			client.CanWrite = canWrite
+			client.send(CollabMessage{Type: CollabMessageAccess, Revision: len(session.history), CanWrite: canWrite})
+		}
+	}
+	return nil
+}
+
+// persist сохраняет содержимое сессии в документ, если с прошлого сохранения
+// были правки. Если документ был изменён в обход сессии (например, через PUT),
+// эта правка переносится в сессию как операция и рассылается клиентам.
+// Состояние сессии копируется под session.mu, а база читается и пишется без неё.
+func (h *CollabHub) persist(session *collabSession) error {
+	session.persistMu.Lock()
+	defer session.persistMu.Unlock()
+
+	session.mu.Lock()
+	if len(session.pending) == 0 {
+		session.mu.Unlock()
+		return nil
+	}
+	content := session.content
+	persistedContent := session.persistedContent
+	pending := append([]utils.TextOperation(nil), session.pending...)
+	documentRevision := session.documentRevision
+	editor := &utils.JWTCustomClaims{ID: session.lastEditor, Username: session.lastEditorName}
+	session.mu.Unlock()
+
+	var external utils.TextOperation
+	revision := documentRevision
+	// Текст до записи и записанный документ — для уведомлений об упоминаниях.
+	var previousContent string
+	var written *models.Document
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var document models.Document
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&document, session.documentID).Error; err != nil {
+			return err
+		}
+
+		if document.Revision != documentRevision {
+			external = utils.DiffOperation(persistedContent, document.Content)
+			var err error
+			for _, concurrent := range pending {
+				if external, _, err = utils.TransformOperations(external, concurrent); err != nil {
+					return err
+				}
+			}
+			if content, err = external.Apply(content); err != nil {
+				return err
+			}
+		}
+
+		revision = document.Revision
+		if content == document.Content {
+			return nil
+		}
+
+		updated := document
+		updated.Content = content
+		if err := h.versionService.Snapshot(tx, document, updated, editor.ID); err != nil {
+			return err
+		}
+		if err := ReanchorDocument(tx, document.ID, document.Content, content); err != nil {
+			return err
+		}
+
+		revision = document.Revision + 1
+		updated.Revision = revision
+		previousContent, written = document.Content, &updated
+		return tx.Model(&document).Updates(map[string]interface{}{
+			"content":  content,
+			"revision": revision,
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Документ удалён — сохранять некуда.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if written != nil {
+		if err := h.mentionService.NotifyNewMentions(written, editor, previousContent, written.Content); err != nil {
+			log.Printf("Failed to notify mentions in document %d: %v", written.ID, err)
+		}
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	// Правки, пришедшие во время записи, в базу не попали и остаются в pending.
+	later := session.pending[len(pending):]
+	if !external.IsNoop() {
+		// Внешняя правка уже в базе, поэтому оставшиеся операции
+		// переносятся поверх неё, а сама она — поверх них.
+		remaining := make([]utils.TextOperation, len(later))
+		for i, op := range later {
+			if external, remaining[i], err = utils.TransformOperations(external, op); err != nil {
+				return err
+			}
+		}
+		merged, err := external.Apply(session.content)
+		if err != nil {
+			return err
+		}
+		session.apply(merged, external)
+		session.broadcast(nil, CollabMessage{
+			Type:      CollabMessageOperation,
+			Revision:  len(session.history),
+			Operation: external,
+		})
+		later = remaining
+	}
+
+	session.persistedContent = content
+	session.pending = append([]utils.TextOperation(nil), later...)
+	session.documentRevision = revision
+	return nil
+}
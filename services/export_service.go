@@ -21,8 +21,8 @@ func (es *ExportService) ExportDocumentToJSON(documentID uint, userID uint) (str
 	var document models.Document
 	if err := es.db.Preload("Tags").
 		Preload("Versions").
-		Where("id = ? AND (user_id = ? OR id IN (SELECT document_id FROM document_shares WHERE user_id = ?))",
-			documentID, userID, userID).
+		Scopes(AccessibleDocuments(userID)).
+		Where("documents.id = ?", documentID).
 		First(&document).Error; err != nil {
 		return "", err
 	}
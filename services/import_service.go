@@ -26,6 +26,7 @@ func (is *ImportService) ImportDocumentFromJSON(reader io.Reader, userID uint) (
 
 	document.ID = 0
 	document.UserID = userID
+	document.Revision = 1
 
 	err := is.db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Create(&document).Error; err != nil {
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Mailer отправляет письма пользователям. Для разработки есть реализация,
+// которая пишет письма в файлы или в лог вместо отправки.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPMailer(host string, port int, username, password, from string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPMailer{addr: fmt.Sprintf("%s:%d", host, port), auth: auth, from: from}
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, composeMessage(m.from, to, subject, body))
+}
+
+// DevMailer сохраняет письма в каталог dir, а если он не задан, выводит их в лог.
+type DevMailer struct {
+	dir  string
+	from string
+}
+
+func NewDevMailer(dir, from string) *DevMailer {
+	return &DevMailer{dir: dir, from: from}
+}
+
+func (m *DevMailer) Send(to, subject, body string) error {
+	message := composeMessage(m.from, to, subject, body)
+	if m.dir == "" {
+		log.Printf("Письмо для %s:\n%s", to, message)
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000000"), sanitizeFileName(to))
+	return os.WriteFile(filepath.Join(m.dir, name), message, 0o600)
+}
+
+func composeMessage(from, to, subject, body string) []byte {
+	// Переводы строк в заголовках позволили бы подставить свои заголовки.
+	stripNewlines := strings.NewReplacer("\r", "", "\n", "")
+	from, to, subject = stripNewlines.Replace(from), stripNewlines.Replace(to), stripNewlines.Replace(subject)
+
+	headers := []string{
+		"From: " + from,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+	return []byte(strings.Join(headers, "\r\n") + "\r\n\r\n" + strings.ReplaceAll(body, "\n", "\r\n"))
+}
+
+func sanitizeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/utils"
+
+	"gorm.io/gorm"
+)
+
+type MentionService struct {
+	db                  *gorm.DB
+	notificationService *NotificationService
+}
+
+type ResolvedMention struct {
+	UserID   uint
+	Username string
+	Offset   int
+}
+
+func NewMentionService(db *gorm.DB, notificationService *NotificationService) *MentionService {
+	return &MentionService{db: db, notificationService: notificationService}
+}
+
+// Resolve сопоставляет упоминания с пользователями. Несуществующие имена
+// пропускаются, пользователи без доступа к документу возвращаются отдельно.
+func (ms *MentionService) Resolve(document *models.Document, mentions []utils.Mention) ([]ResolvedMention, []string, error) {
+	if len(mentions) == 0 {
+		return nil, nil, nil
+	}
+
+	usernames := make([]string, 0, len(mentions))
+	for _, m := range mentions {
+		usernames = append(usernames, m.Username)
+	}
+
+	var users []models.User
+	if err := ms.db.Where("username IN ?", usernames).Find(&users).Error; err != nil {
+		return nil, nil, err
+	}
+	byUsername := make(map[string]models.User, len(users))
+	for _, u := range users {
+		byUsername[u.Username] = u
+	}
+
+	var resolved []ResolvedMention
+	var withoutAccess []string
+	access := make(map[uint]bool)
+
+	for _, m := range mentions {
+		user, ok := byUsername[m.Username]
+		if !ok {
+			continue
+		}
+
+		hasAccess, checked := access[user.ID]
+		if !checked {
+			var err error
+			if hasAccess, err = HasDocumentAccess(ms.db, document, user.ID); err != nil {
+				return nil, nil, err
+			}
+			access[user.ID] = hasAccess
+			if !hasAccess {
+				withoutAccess = append(withoutAccess, user.Username)
+			}
+		}
+
+		if hasAccess {
+			resolved = append(resolved, ResolvedMention{UserID: user.ID, Username: user.Username, Offset: m.Offset})
+		}
+	}
+
+	return resolved, withoutAccess, nil
+}
+
+// NotifyComment уведомляет упомянутых в комментарии пользователей.
+func (ms *MentionService) NotifyComment(document *models.Document, comment *models.Comment, sender *utils.JWTCustomClaims, mentions []ResolvedMention) error {
+	content := fmt.Sprintf("%s mentioned you in a comment on \"%s\"", sender.Username, document.Title)
+	return ms.notify(document, sender.ID, mentions, func(n *models.Notification, m ResolvedMention) {
+		n.Content = content
+		n.CommentID = &comment.ID
+	})
+}
+
+// NotifyDocument уведомляет упомянутых в тексте документа пользователей,
+// указывая позицию упоминания.
+func (ms *MentionService) NotifyDocument(document *models.Document, sender *utils.JWTCustomClaims, mentions []ResolvedMention) error {
+	content := fmt.Sprintf("%s mentioned you in \"%s\"", sender.Username, document.Title)
+	return ms.notify(document, sender.ID, mentions, func(n *models.Notification, m ResolvedMention) {
+		offset := m.Offset
+		n.Content = content
+		n.Offset = &offset
+	})
+}
+
+// NotifyNewMentions уведомляет пользователей, упомянутых в after, но не в
+// before. Пользователи без доступа пропускаются: текст уже сохранён, и
+// отклонить правку на этом шаге нельзя.
+func (ms *MentionService) NotifyNewMentions(document *models.Document, sender *utils.JWTCustomClaims, before, after string) error {
+	mentions, _, err := ms.Resolve(document, NewMentions(before, after))
+	if err != nil {
+		return err
+	}
+	return ms.NotifyDocument(document, sender, mentions)
+}
+
+func (ms *MentionService) notify(document *models.Document, senderID uint, mentions []ResolvedMention, fill func(*models.Notification, ResolvedMention)) error {
+	notified := map[uint]bool{senderID: true}
+	for _, m := range mentions {
+		if notified[m.UserID] {
+			continue
+		}
+		notified[m.UserID] = true
+
+		notification := models.Notification{
+			UserID:     m.UserID,
+			SenderID:   senderID,
+			DocumentID: document.ID,
+			Type:       models.NotificationMention,
+		}
+		fill(&notification, m)
+		if err := ms.notificationService.Send(notification); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewMentions возвращает упоминания из текста after, имён которых не было в before.
+func NewMentions(before, after string) []utils.Mention {
+	existing := make(map[string]bool)
+	for _, m := range utils.ParseMentions(before) {
+		existing[m.Username] = true
+	}
+
+	var mentions []utils.Mention
+	for _, m := range utils.ParseMentions(after) {
+		if !existing[m.Username] {
+			mentions = append(mentions, m)
+		}
+	}
+	return mentions
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"sync"
+
+	"github.com/NutsBalls/Nexus/models"
+)
+
+// NotificationBroadcaster доставляет созданные уведомления подписчикам.
+// Реализация в памяти работает в пределах одного процесса; для нескольких
+// экземпляров сервера её можно заменить, например, на Postgres LISTEN/NOTIFY.
+type NotificationBroadcaster interface {
+	Publish(notification models.Notification)
+	// Subscribe возвращает канал уведомлений пользователя и функцию отписки.
+	// Канал закрывается, если подписчик не успевает читать.
+	Subscribe(userID uint) (<-chan models.Notification, func())
+}
+
+type InProcessBroadcaster struct {
+	mu          sync.Mutex
+	subscribers map[uint]map[chan models.Notification]struct{}
+}
+
+func NewInProcessBroadcaster() *InProcessBroadcaster {
+	return &InProcessBroadcaster{
+		subscribers: make(map[uint]map[chan models.Notification]struct{}),
+	}
+}
+
+func (b *InProcessBroadcaster) Publish(notification models.Notification) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers[notification.UserID] {
+		select {
+		case ch <- notification:
+		default:
+			b.remove(notification.UserID, ch)
+		}
+	}
+}
+
+func (b *InProcessBroadcaster) Subscribe(userID uint) (<-chan models.Notification, func()) {
+	ch := make(chan models.Notification, 16)
+
+	b.mu.Lock()
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = make(map[chan models.Notification]struct{})
+	}
+	b.subscribers[userID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(userID, ch)
+	}
+}
+
+func (b *InProcessBroadcaster) remove(userID uint, ch chan models.Notification) {
+	subscribers := b.subscribers[userID]
+	if _, ok := subscribers[ch]; !ok {
+		return
+	}
+
+	delete(subscribers, ch)
+	close(ch)
+	if len(subscribers) == 0 {
+		delete(b.subscribers, userID)
+	}
+}
@@ -7,33 +7,61 @@ import (
 )
 
 type NotificationService struct {
-	db *gorm.DB
+	db          *gorm.DB
+	broadcaster NotificationBroadcaster
 }
 
-func NewNotificationService(db *gorm.DB) *NotificationService {
-	return &NotificationService{db: db}
+func NewNotificationService(db *gorm.DB, broadcaster NotificationBroadcaster) *NotificationService {
+	return &NotificationService{db: db, broadcaster: broadcaster}
 }
 
 func (ns *NotificationService) CreateNotification(userID uint, senderID uint, documentID uint, notificationType models.NotificationType, content string) error {
-	notification := models.Notification{
+	return ns.Send(models.Notification{
 		UserID:     userID,
 		SenderID:   senderID,
 		DocumentID: documentID,
 		Type:       notificationType,
 		Content:    content,
+	})
+}
+
+func (ns *NotificationService) Send(notification models.Notification) error {
+	if err := ns.db.Create(&notification).Error; err != nil {
+		return err
 	}
 
-	return ns.db.Create(&notification).Error
+	ns.broadcaster.Publish(notification)
+	return nil
 }
 
+// NotifyCollaborators уведомляет всех, у кого есть доступ к документу,
+// кроме самого отправителя.
 func (ns *NotificationService) NotifyCollaborators(documentID uint, senderID uint, notificationType models.NotificationType, content string) error {
-	var collaborators []models.Collaboration
-	if err := ns.db.Where("document_id = ? AND user_id != ?", documentID, senderID).Find(&collaborators).Error; err != nil {
+	return ns.notifyAudience(documentID, senderID, models.PermissionRead, notificationType, content)
+}
+
+// NotifyEditors уведомляет пользователей с правом записи в документ,
+// кроме самого отправителя.
+func (ns *NotificationService) NotifyEditors(documentID uint, senderID uint, notificationType models.NotificationType, content string) error {
+	return ns.notifyAudience(documentID, senderID, models.PermissionWrite, notificationType, content)
+}
+
+func (ns *NotificationService) notifyAudience(documentID uint, senderID uint, required models.SharePermission, notificationType models.NotificationType, content string) error {
+	var document models.Document
+	if err := ns.db.First(&document, documentID).Error; err != nil {
+		return err
+	}
+
+	recipients, err := DocumentAudience(ns.db, &document, required)
+	if err != nil {
 		return err
 	}
 
-	for _, collaborator := range collaborators {
-		if err := ns.CreateNotification(collaborator.UserID, senderID, documentID, notificationType, content); err != nil {
+	for _, userID := range recipients {
+		if userID == senderID {
+			continue
+		}
+		if err := ns.CreateNotification(userID, senderID, documentID, notificationType, content); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/NutsBalls/Nexus/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrOwnerChanged означает, что владелец объекта сменился после того,
+// как была запрошена передача.
+var ErrOwnerChanged = errors.New("owner changed since the transfer was requested")
+
+// TransferTarget возвращает тип и идентификатор передаваемого объекта.
+func TransferTarget(transfer *models.OwnershipTransfer) (string, uint) {
+	if transfer.FolderID != nil {
+		return "folder", *transfer.FolderID
+	}
+	return "document", *transfer.DocumentID
+}
+
+// ApplyOwnershipTransfer передаёт получателю документ или папку вместе с
+// документами прежнего владельца в ней. Должна вызываться в транзакции.
+// Вложения следуют за документами, теги переходят к получателю, если
+// у прежнего владельца не осталось других документов с ними.
+// Возвращает идентификаторы переданных документов.
+func ApplyOwnershipTransfer(tx *gorm.DB, transfer *models.OwnershipTransfer) ([]uint, error) {
+	var documentIDs []uint
+	var keepShare models.Share
+
+	if transfer.FolderID != nil {
+		var folder models.Folder
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&folder, *transfer.FolderID).Error; err != nil {
+			return nil, err
+		}
+		if folder.UserID != transfer.FromUserID {
+			return nil, ErrOwnerChanged
+		}
+		if err := tx.Model(&folder).Update("user_id", transfer.ToUserID).Error; err != nil {
+			return nil, err
+		}
+		// Чужие документы в папке остаются у своих владельцев.
+		if err := tx.Model(&models.Document{}).
+			Where("folder_id = ? AND user_id = ?", folder.ID, transfer.FromUserID).
+			Pluck("id", &documentIDs).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Where("user_id = ? AND folder_id = ?", transfer.ToUserID, folder.ID).Delete(&models.Share{}).Error; err != nil {
+			return nil, err
+		}
+		keepShare.FolderID = &folder.ID
+	} else {
+		var document models.Document
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&document, *transfer.DocumentID).Error; err != nil {
+			return nil, err
+		}
+		if document.UserID != transfer.FromUserID {
+			return nil, ErrOwnerChanged
+		}
+		documentIDs = []uint{document.ID}
+		keepShare.DocumentID = &document.ID
+	}
+
+	if len(documentIDs) > 0 {
+		if err := tx.Model(&models.Document{}).Where("id IN ?", documentIDs).Update("user_id", transfer.ToUserID).Error; err != nil {
+			return nil, err
+		}
+		// Личный доступ получателя к собственным документам больше не нужен.
+		if err := tx.Where("user_id = ? AND document_id IN ?", transfer.ToUserID, documentIDs).Delete(&models.Share{}).Error; err != nil {
+			return nil, err
+		}
+
+		linked := tx.Session(&gorm.Session{NewDB: true}).
+			Table("document_tags").
+			Select("tag_id").
+			Where("document_id IN ?", documentIDs)
+		stillUsed := tx.Session(&gorm.Session{NewDB: true}).
+			Table("document_tags").
+			Select("document_tags.tag_id").
+			Joins("JOIN documents ON documents.id = document_tags.document_id").
+			Where("documents.user_id = ?", transfer.FromUserID)
+		if err := tx.Model(&models.Tag{}).
+			Where("user_id = ? AND id IN (?) AND id NOT IN (?)", transfer.FromUserID, linked, stillUsed).
+			Update("user_id", transfer.ToUserID).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if transfer.KeepAccess {
+		keepShare.UserID = &transfer.FromUserID
+		keepShare.Permission = models.PermissionAdmin
+		keepShare.CreatedByID = transfer.ToUserID
+		if err := tx.Create(&keepShare).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return documentIDs, nil
+}
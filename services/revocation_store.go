@@ -0,0 +1,196 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Как долго кэш доверяет тому, что токен или пользователь не отозваны.
+// Отзыв на другом экземпляре сервера вступает в силу не позже этого срока.
+const revocationRecheckInterval = 30 * time.Second
+
+// Как часто из кэша и таблицы удаляются записи об истёкших токенах.
+const revocationPurgeInterval = time.Hour
+
+type revocationEntry struct {
+	revoked bool
+	// До какого момента запись в кэше актуальна: для отозванного токена —
+	// до истечения его срока, для действующего — до следующей проверки.
+	validUntil time.Time
+}
+
+type userCutoffEntry struct {
+	cutoff     *time.Time
+	validUntil time.Time
+}
+
+// RevocationStore хранит отозванные access-токены в таблице revoked_tokens
+// и кэширует результаты проверок в памяти.
+type RevocationStore struct {
+	db *gorm.DB
+
+	mu      sync.RWMutex
+	tokens  map[string]revocationEntry
+	cutoffs map[uint]userCutoffEntry
+
+	stop chan struct{}
+}
+
+func NewRevocationStore(db *gorm.DB) *RevocationStore {
+	return &RevocationStore{
+		db:      db,
+		tokens:  make(map[string]revocationEntry),
+		cutoffs: make(map[uint]userCutoffEntry),
+		stop:    make(chan struct{}),
+	}
+}
+
+func (s *RevocationStore) Start() {
+	go s.run()
+}
+
+func (s *RevocationStore) Stop() {
+	close(s.stop)
+}
+
+func (s *RevocationStore) run() {
+	ticker := time.NewTicker(revocationPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Purge(); err != nil {
+				log.Printf("Failed to purge revoked tokens: %v", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Revoke отзывает токен до истечения его срока.
+func (s *RevocationStore) Revoke(claims *utils.JWTCustomClaims) error {
+	if claims.Id == "" {
+		return errors.New("token has no jti")
+	}
+
+	expiresAt := time.Unix(claims.ExpiresAt, 0)
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RevokedToken{
+		JTI:       claims.Id,
+		UserID:    claims.ID,
+		ExpiresAt: expiresAt,
+	}).Error; err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.tokens[claims.Id] = revocationEntry{revoked: true, validUntil: expiresAt}
+	s.mu.Unlock()
+	return nil
+}
+
+// RevokeUser отзывает все access-токены пользователя, выпущенные до этого момента.
+func (s *RevocationStore) RevokeUser(userID uint) error {
+	now := time.Now()
+	if err := s.db.Model(&models.User{}).Where("id = ?", userID).Update("tokens_revoked_at", now).Error; err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.cutoffs[userID] = userCutoffEntry{cutoff: &now, validUntil: now.Add(revocationRecheckInterval)}
+	s.mu.Unlock()
+	return nil
+}
+
+// IsRevoked сообщает, отозван ли токен лично или вместе со всеми токенами пользователя.
+func (s *RevocationStore) IsRevoked(claims *utils.JWTCustomClaims) (bool, error) {
+	cutoff, err := s.userCutoff(claims.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	// iat хранится с точностью до секунды, поэтому токен, выпущенный
+	// в ту же секунду, что и отзыв, тоже считается отозванным.
+	if cutoff != nil && claims.IssuedAt <= cutoff.Unix() {
+		return true, nil
+	}
+
+	// Токены, выпущенные до появления jti, можно отозвать только целиком.
+	if claims.Id == "" {
+		return false, nil
+	}
+
+	now := time.Now()
+	s.mu.RLock()
+	entry, ok := s.tokens[claims.Id]
+	s.mu.RUnlock()
+	if ok && now.Before(entry.validUntil) {
+		return entry.revoked, nil
+	}
+
+	var count int64
+	if err := s.db.Model(&models.RevokedToken{}).Where("jti = ?", claims.Id).Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	entry = revocationEntry{revoked: count > 0, validUntil: now.Add(revocationRecheckInterval)}
+	if entry.revoked {
+		entry.validUntil = time.Unix(claims.ExpiresAt, 0)
+	}
+	s.mu.Lock()
+	s.tokens[claims.Id] = entry
+	s.mu.Unlock()
+
+	return entry.revoked, nil
+}
+
+func (s *RevocationStore) userCutoff(userID uint) (*time.Time, error) {
+	now := time.Now()
+	s.mu.RLock()
+	entry, ok := s.cutoffs[userID]
+	s.mu.RUnlock()
+	if ok && now.Before(entry.validUntil) {
+		return entry.cutoff, nil
+	}
+
+	var user models.User
+	if err := s.db.Select("id", "tokens_revoked_at").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.cutoffs[userID] = userCutoffEntry{cutoff: user.TokensRevokedAt, validUntil: now.Add(revocationRecheckInterval)}
+	s.mu.Unlock()
+	return user.TokensRevokedAt, nil
+}
+
+// Purge удаляет записи о токенах, срок которых истёк.
+func (s *RevocationStore) Purge() error {
+	now := time.Now()
+
+	s.mu.Lock()
+	for jti, entry := range s.tokens {
+		if !now.Before(entry.validUntil) {
+			delete(s.tokens, jti)
+		}
+	}
+	for userID, entry := range s.cutoffs {
+		if !now.Before(entry.validUntil) {
+			delete(s.cutoffs, userID)
+		}
+	}
+	s.mu.Unlock()
+
+	return s.db.Where("expires_at <= ?", now).Delete(&models.RevokedToken{}).Error
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/NutsBalls/Nexus/models"
+
+	"gorm.io/gorm"
+)
+
+const expiryTimeLayout = "2006-01-02 15:04 MST"
+
+// ShareExpiryService периодически удаляет истёкшие права доступа и ссылки
+// и заранее предупреждает об истечении получателя и того, кто выдал доступ.
+type ShareExpiryService struct {
+	db                  *gorm.DB
+	notificationService *NotificationService
+	interval            time.Duration
+	warning             time.Duration
+	stop                chan struct{}
+}
+
+func NewShareExpiryService(db *gorm.DB, notificationService *NotificationService, interval, warning time.Duration) *ShareExpiryService {
+	return &ShareExpiryService{
+		db:                  db,
+		notificationService: notificationService,
+		interval:            interval,
+		warning:             warning,
+		stop:                make(chan struct{}),
+	}
+}
+
+func (s *ShareExpiryService) Start() {
+	go s.run()
+}
+
+func (s *ShareExpiryService) Stop() {
+	close(s.stop)
+}
+
+func (s *ShareExpiryService) run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Sweep(); err != nil {
+			log.Printf("Failed to sweep expired shares: %v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *ShareExpiryService) Sweep() error {
+	now := time.Now()
+	if err := s.warnExpiring(now); err != nil {
+		return err
+	}
+
+	result := s.db.Where("expires_at IS NOT NULL AND expires_at <= ?", now).Delete(&models.Share{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Removed %d expired shares", result.RowsAffected)
+	}
+
+	result = s.db.Where("expires_at IS NOT NULL AND expires_at <= ?", now).Delete(&models.ShareLink{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Removed %d expired share links", result.RowsAffected)
+	}
+	return nil
+}
+
+func (s *ShareExpiryService) warnExpiring(now time.Time) error {
+	if s.warning <= 0 {
+		return nil
+	}
+
+	var shares []models.Share
+	if err := s.db.Preload("Document").Preload("Folder").Preload("User").Preload("Workspace").
+		Where("expires_at > ? AND expires_at <= ? AND expiry_notified_at IS NULL", now, now.Add(s.warning)).
+		Find(&shares).Error; err != nil {
+		return err
+	}
+
+	for _, share := range shares {
+		// Отметка ставится условно, чтобы при нескольких экземплярах
+		// сервера предупреждение ушло один раз.
+		result := s.db.Model(&models.Share{}).
+			Where("id = ? AND expiry_notified_at IS NULL", share.ID).
+			Update("expiry_notified_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		expiresAt := share.ExpiresAt.Format(expiryTimeLayout)
+		target := fmt.Sprintf("\"%s\"", share.Document.Title)
+		if share.FolderID != nil {
+			target = fmt.Sprintf("folder \"%s\"", share.Folder.Name)
+		}
+
+		var recipients []uint
+		grantee := ""
+		if share.UserID != nil {
+			recipients = []uint{*share.UserID}
+			grantee = share.User.Username
+		} else if share.WorkspaceID != nil {
+			var err error
+			if recipients, err = WorkspaceShareRecipients(s.db, *share.WorkspaceID); err != nil {
+				return err
+			}
+			grantee = fmt.Sprintf("team \"%s\"", share.Workspace.Name)
+		}
+
+		notifications := []models.Notification{shareNotification(share, share.CreatedByID, share.CreatedByID,
+			fmt.Sprintf("Access of %s to %s expires at %s", grantee, target, expiresAt))}
+		for _, userID := range recipients {
+			if userID == share.CreatedByID {
+				continue
+			}
+			notifications = append(notifications, shareNotification(share, userID, share.CreatedByID,
+				fmt.Sprintf("Your access to %s expires at %s", target, expiresAt)))
+		}
+
+		for _, notification := range notifications {
+			if err := s.notificationService.Send(notification); err != nil {
+				log.Printf("Failed to notify user %d about expiring share %d: %v", notification.UserID, share.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func shareNotification(share models.Share, userID, senderID uint, content string) models.Notification {
+	notification := models.Notification{
+		UserID:   userID,
+		SenderID: senderID,
+		Type:     models.NotificationExpiry,
+		Content:  content,
+		FolderID: share.FolderID,
+	}
+	if share.DocumentID != nil {
+		notification.DocumentID = *share.DocumentID
+	}
+	return notification
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/NutsBalls/Nexus/utils"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Срок жизни билета: его нужно сразу использовать для подключения.
+const streamTicketTTL = 30 * time.Second
+
+type streamTicket struct {
+	token     *jwt.Token
+	expiresAt time.Time
+}
+
+// TicketStore выдаёт короткоживущие одноразовые билеты для WebSocket и
+// EventSource: браузер не умеет передавать им заголовок Authorization,
+// а сам токен в query-параметре попал бы в логи. Билеты хранятся в памяти,
+// как и сессии, к которым они открывают доступ.
+type TicketStore struct {
+	mu      sync.Mutex
+	tickets map[string]streamTicket
+}
+
+func NewTicketStore() *TicketStore {
+	return &TicketStore{tickets: make(map[string]streamTicket)}
+}
+
+// Issue выдаёт билет от имени владельца token.
+func (s *TicketStore) Issue(token *jwt.Token) (string, time.Duration, error) {
+	ticket, err := utils.RandomToken(32)
+	if err != nil {
+		return "", 0, err
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, t := range s.tickets {
+		if !now.Before(t.expiresAt) {
+			delete(s.tickets, hash)
+		}
+	}
+	s.tickets[utils.HashToken(ticket)] = streamTicket{token: token, expiresAt: now.Add(streamTicketTTL)}
+	return ticket, streamTicketTTL, nil
+}
+
+// Redeem погашает билет и возвращает токен, от имени которого он выдан.
+func (s *TicketStore) Redeem(ticket string) (*jwt.Token, bool) {
+	hash := utils.HashToken(ticket)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tickets[hash]
+	if !ok {
+		return nil, false
+	}
+	delete(s.tickets, hash)
+	if !time.Now().Before(t.expiresAt) {
+		return nil, false
+	}
+	return t.token, true
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused означает повторное предъявление уже обменянного
+	// токена: он мог быть украден, поэтому всё семейство отзывается.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// TokenService выпускает и отзывает access-токены JWT и ротирует refresh-токены.
+type TokenService struct {
+	db          *gorm.DB
+	revocations *RevocationStore
+	keys        *utils.KeySet
+	accessTTL   time.Duration
+	refreshTTL  time.Duration
+}
+
+func NewTokenService(db *gorm.DB, revocations *RevocationStore, keys *utils.KeySet, accessTTL, refreshTTL time.Duration) *TokenService {
+	return &TokenService{
+		db:          db,
+		revocations: revocations,
+		keys:        keys,
+		accessTTL:   accessTTL,
+		refreshTTL:  refreshTTL,
+	}
+}
+
+// IssueTokens начинает новое семейство refresh-токенов, например при входе.
+func (s *TokenService) IssueTokens(user *models.User) (*TokenPair, error) {
+	familyID, err := utils.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	return s.issue(s.db, user, familyID)
+}
+
+// Refresh обменивает refresh-токен на новую пару токенов. Старый токен
+// после этого недействителен.
+func (s *TokenService) Refresh(rawToken string) (*TokenPair, error) {
+	var reused *models.RefreshToken
+	var pair *TokenPair
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var token models.RefreshToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("User").
+			Where("token_hash = ?", utils.HashToken(rawToken)).
+			First(&token).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+
+		if token.RevokedAt != nil {
+			return ErrInvalidRefreshToken
+		}
+		if token.UsedAt != nil {
+			reused = &token
+			return ErrRefreshTokenReused
+		}
+		if !token.ExpiresAt.After(time.Now()) {
+			return ErrInvalidRefreshToken
+		}
+
+		if err := tx.Model(&token).Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		pair, err = s.issue(tx, &token.User, token.FamilyID)
+		return err
+	})
+
+	// Семейство отзывается вне откатившейся транзакции.
+	if reused != nil {
+		if revokeErr := s.RevokeFamily(reused.FamilyID); revokeErr != nil {
+			return nil, revokeErr
+		}
+		log.Printf("Refresh token reuse for user %d, family %s revoked", reused.UserID, reused.FamilyID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// Logout отзывает текущий access-токен и, если он передан, refresh-токен
+// вместе с его семейством.
+func (s *TokenService) Logout(claims *utils.JWTCustomClaims, rawRefreshToken string) error {
+	if claims.Id != "" {
+		if err := s.revocations.Revoke(claims); err != nil {
+			return err
+		}
+	}
+	if rawRefreshToken == "" {
+		return nil
+	}
+
+	var token models.RefreshToken
+	err := s.db.Where("token_hash = ? AND user_id = ?", utils.HashToken(rawRefreshToken), claims.ID).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.RevokeFamily(token.FamilyID)
+}
+
+// LogoutEverywhere отзывает все access- и refresh-токены пользователя.
+func (s *TokenService) LogoutEverywhere(userID uint) error {
+	if err := s.revocations.RevokeUser(userID); err != nil {
+		return err
+	}
+	return s.db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeFamily отзывает все ещё действующие токены семейства.
+func (s *TokenService) RevokeFamily(familyID string) error {
+	return s.db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (s *TokenService) issue(db *gorm.DB, user *models.User, familyID string) (*TokenPair, error) {
+	rawToken, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := db.Create(&models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: utils.HashToken(rawToken),
+		ExpiresAt: now.Add(s.refreshTTL),
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	accessToken, err := utils.CreateJWTToken(user.ID, user.Username, user.Email, s.keys, now.Add(s.accessTTL).Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: rawToken,
+		ExpiresIn:    int64(s.accessTTL / time.Second),
+	}, nil
+}
@@ -0,0 +1,136 @@
+package services_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/NutsBalls/Nexus/config"
+	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/services"
+	"github.com/NutsBalls/Nexus/utils"
+	"gorm.io/gorm"
+)
+
+// refreshStep обменивает токен use и, если обмен успешен, сохраняет новый
+// под именем as. При expire срок токена use перед обменом истекает.
+type refreshStep struct {
+	use    string
+	as     string
+	expire bool
+	err    error
+}
+
+func TestRefreshReuseDetection(t *testing.T) {
+	db := openTestDB(t)
+	tokenService := services.NewTokenService(db, services.NewRevocationStore(db), utils.NewHMACKeySet([]byte("test-secret")), time.Minute, time.Hour)
+
+	// У каждого случая два независимых входа: login и other.
+	tests := []struct {
+		name  string
+		steps []refreshStep
+	}{
+		{"rotation", []refreshStep{
+			{use: "login", as: "r1"},
+			{use: "r1", as: "r2"},
+			{use: "r2"},
+		}},
+		{"reuse revokes the rotated token", []refreshStep{
+			{use: "login", as: "r1"},
+			{use: "login", err: services.ErrRefreshTokenReused},
+			{use: "r1", err: services.ErrInvalidRefreshToken},
+		}},
+		{"reuse deep in the chain", []refreshStep{
+			{use: "login", as: "r1"},
+			{use: "r1", as: "r2"},
+			{use: "r1", err: services.ErrRefreshTokenReused},
+			{use: "r2", err: services.ErrInvalidRefreshToken},
+		}},
+		{"other sessions survive reuse", []refreshStep{
+			{use: "login", as: "r1"},
+			{use: "login", err: services.ErrRefreshTokenReused},
+			{use: "other", as: "o1"},
+			{use: "o1"},
+		}},
+		{"reuse after revocation is not reported again", []refreshStep{
+			{use: "login", as: "r1"},
+			{use: "login", err: services.ErrRefreshTokenReused},
+			{use: "login", err: services.ErrInvalidRefreshToken},
+		}},
+		{"expired token", []refreshStep{
+			{use: "login", expire: true, err: services.ErrInvalidRefreshToken},
+		}},
+		{"unknown token", []refreshStep{
+			{use: "unknown", err: services.ErrInvalidRefreshToken},
+		}},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suffix := fmt.Sprintf("%d-%d", time.Now().UnixNano(), i)
+			user := models.User{Username: "refresh-" + suffix, Email: "refresh-" + suffix + "@example.com", Password: "-"}
+			if err := db.Create(&user).Error; err != nil {
+				t.Fatalf("create user: %v", err)
+			}
+
+			raw := map[string]string{"unknown": "not-a-token"}
+			for _, name := range []string{"login", "other"} {
+				pair, err := tokenService.IssueTokens(&user)
+				if err != nil {
+					t.Fatalf("issue tokens: %v", err)
+				}
+				raw[name] = pair.RefreshToken
+			}
+
+			for n, step := range tt.steps {
+				if step.expire {
+					if err := db.Model(&models.RefreshToken{}).
+						Where("token_hash = ?", utils.HashToken(raw[step.use])).
+						Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+						t.Fatalf("expire token: %v", err)
+					}
+				}
+
+				pair, err := tokenService.Refresh(raw[step.use])
+				if !errors.Is(err, step.err) {
+					t.Fatalf("step %d: refresh %s: error = %v, want %v", n, step.use, err, step.err)
+				}
+				if err == nil && step.as != "" {
+					raw[step.as] = pair.RefreshToken
+				}
+			}
+		})
+	}
+}
+
+// openTestDB подключается к базе TEST_DB_NAME так же, как тесты маршрутов
+// в main_test.go. Без TEST_DB_NAME тест пропускается.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	name := os.Getenv("TEST_DB_NAME")
+	if name == "" {
+		t.Skip("TEST_DB_NAME is not set")
+	}
+
+	db, err := config.InitDB(&config.Config{
+		DBHost:     envOr("DB_HOST", "localhost"),
+		DBUser:     envOr("DB_USER", "postgres"),
+		DBPassword: os.Getenv("DB_PASSWORD"),
+		DBName:     name,
+		DBPort:     envOr("DB_PORT", "5432"),
+	})
+	if err != nil {
+		t.Fatalf("connect to test database: %v", err)
+	}
+	return db
+}
+
+func envOr(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,313 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/NutsBalls/Nexus/models"
+	"github.com/NutsBalls/Nexus/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	totpIssuer                = "Nexus"
+	recoveryCodeCount         = 10
+	loginChallengeTTL         = 5 * time.Minute
+	loginChallengeMaxAttempts = 5
+	// Лимит неверных кодов на пользователя: новый токен второго шага его не сбрасывает.
+	twoFactorMaxFailures = 5
+	twoFactorLockout     = 15 * time.Minute
+)
+
+var (
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotSetUp    = errors.New("two-factor authentication has not been set up")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	ErrInvalidChallenge     = errors.New("invalid or expired login challenge")
+	ErrTwoFactorLocked      = errors.New("too many invalid two-factor codes")
+)
+
+// TwoFactorService управляет TOTP, кодами восстановления и вторым шагом входа.
+type TwoFactorService struct {
+	db *gorm.DB
+}
+
+func NewTwoFactorService(db *gorm.DB) *TwoFactorService {
+	return &TwoFactorService{db: db}
+}
+
+// BeginSetup создаёт новый секрет TOTP. Он начнёт требоваться при входе
+// только после подтверждения кодом из приложения.
+func (s *TwoFactorService) BeginSetup(user *models.User) (secret string, uri string, err error) {
+	if user.TOTPEnabled {
+		return "", "", ErrTwoFactorEnabled
+	}
+
+	secret, err = utils.GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.db.Model(user).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+		return "", "", err
+	}
+	return secret, utils.TOTPURI(totpIssuer, user.Email, secret), nil
+}
+
+// Confirm включает 2FA, если код подходит к сохранённому секрету,
+// и возвращает коды восстановления. Они показываются только один раз.
+func (s *TwoFactorService) Confirm(user *models.User, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotSetUp
+	}
+
+	var codes []string
+	err := s.withCode(user, code, s.useTOTP, func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("totp_enabled", true).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = s.replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	return codes, err
+}
+
+// Disable отключает 2FA. Требует действующий код TOTP или код восстановления.
+func (s *TwoFactorService) Disable(user *models.User, code string) error {
+	if !user.TOTPEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	return s.withCode(user, code, s.verifyCode, func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(user).Updates(map[string]interface{}{
+			"totp_enabled":   false,
+			"totp_secret":    "",
+			"totp_last_step": 0,
+		}).Error
+	})
+}
+
+// RegenerateRecoveryCodes заменяет все коды восстановления новыми.
+func (s *TwoFactorService) RegenerateRecoveryCodes(user *models.User, code string) ([]string, error) {
+	if !user.TOTPEnabled {
+		return nil, ErrTwoFactorNotEnabled
+	}
+
+	var codes []string
+	err := s.withCode(user, code, s.useTOTP, func(tx *gorm.DB) error {
+		var err error
+		codes, err = s.replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	return codes, err
+}
+
+// CreateChallenge выдаёт токен второго шага входа, если он не заблокирован
+// после серии неверных кодов.
+func (s *TwoFactorService) CreateChallenge(user *models.User) (string, time.Duration, error) {
+	if user.TwoFactorLocked(time.Now()) {
+		return "", 0, ErrTwoFactorLocked
+	}
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// Заодно удаляются истёкшие попытки входа этого пользователя.
+	if err := s.db.Where("user_id = ? AND expires_at <= ?", user.ID, time.Now()).Delete(&models.LoginChallenge{}).Error; err != nil {
+		return "", 0, err
+	}
+	if err := s.db.Create(&models.LoginChallenge{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(loginChallengeTTL),
+	}).Error; err != nil {
+		return "", 0, err
+	}
+	return token, loginChallengeTTL, nil
+}
+
+// CompleteChallenge проверяет код для токена второго шага и возвращает
+// пользователя. Токен одноразовый и сгорает после нескольких неверных кодов;
+// после twoFactorMaxFailures неверных кодов подряд вход блокируется целиком.
+func (s *TwoFactorService) CompleteChallenge(token, code string) (*models.User, error) {
+	var user models.User
+	var codeErr error
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var challenge models.LoginChallenge
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND expires_at > ?", utils.HashToken(token), time.Now()).
+			First(&challenge).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidChallenge
+		}
+		if err != nil {
+			return err
+		}
+		// Строка пользователя блокируется, чтобы параллельные попытки
+		// с разными токенами считались по очереди.
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, challenge.UserID).Error; err != nil {
+			return err
+		}
+		if user.TwoFactorLocked(time.Now()) {
+			codeErr = ErrTwoFactorLocked
+			return tx.Delete(&challenge).Error
+		}
+
+		// Неверный код не откатывает транзакцию, иначе счётчики попыток не вырастут.
+		codeErr = s.verifyCode(tx, &user, code)
+		if codeErr == nil {
+			if err := tx.Model(&user).Update("totp_failed_attempts", 0).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&challenge).Error
+		}
+		if !errors.Is(codeErr, ErrInvalidTwoFactorCode) {
+			return codeErr
+		}
+
+		locked, err := s.recordFailure(tx, &user)
+		if err != nil || locked {
+			return err
+		}
+		if challenge.Attempts+1 >= loginChallengeMaxAttempts {
+			return tx.Delete(&challenge).Error
+		}
+		return tx.Model(&challenge).Update("attempts", challenge.Attempts+1).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if codeErr != nil {
+		return nil, codeErr
+	}
+	return &user, nil
+}
+
+// withCode проверяет код функцией verify и выполняет apply в одной транзакции.
+// Неверные коды считаются в том же счётчике, что и на втором шаге входа,
+// поэтому перебор кодов из настроек аккаунта блокируется так же.
+func (s *TwoFactorService) withCode(user *models.User, code string, verify func(*gorm.DB, *models.User, string) error, apply func(*gorm.DB) error) error {
+	var codeErr error
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var current models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, user.ID).Error; err != nil {
+			return err
+		}
+		if current.TwoFactorLocked(time.Now()) {
+			codeErr = ErrTwoFactorLocked
+			return nil
+		}
+
+		// Неверный код не откатывает транзакцию, иначе счётчик попыток не вырастет.
+		codeErr = verify(tx, &current, code)
+		if errors.Is(codeErr, ErrInvalidTwoFactorCode) {
+			_, err := s.recordFailure(tx, &current)
+			return err
+		}
+		if codeErr != nil {
+			return codeErr
+		}
+		if err := tx.Model(&current).Update("totp_failed_attempts", 0).Error; err != nil {
+			return err
+		}
+		return apply(tx)
+	})
+	if err != nil {
+		return err
+	}
+	return codeErr
+}
+
+// recordFailure засчитывает неверный код. На twoFactorMaxFailures подряд
+// второй шаг блокируется на twoFactorLockout, а все выданные токены сгорают.
+func (s *TwoFactorService) recordFailure(tx *gorm.DB, user *models.User) (bool, error) {
+	failures := user.TOTPFailedAttempts + 1
+	if failures < twoFactorMaxFailures {
+		return false, tx.Model(user).Update("totp_failed_attempts", failures).Error
+	}
+
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.LoginChallenge{}).Error; err != nil {
+		return false, err
+	}
+	return true, tx.Model(user).Updates(map[string]interface{}{
+		"totp_failed_attempts": 0,
+		"totp_locked_until":    time.Now().Add(twoFactorLockout),
+	}).Error
+}
+
+// verifyCode принимает код TOTP или неиспользованный код восстановления.
+func (s *TwoFactorService) verifyCode(tx *gorm.DB, user *models.User, code string) error {
+	if err := s.useTOTP(tx, user, code); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		return err
+	}
+
+	result := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, utils.HashToken(utils.NormalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// useTOTP проверяет код и запоминает его интервал, чтобы один и тот же код
+// нельзя было использовать дважды.
+func (s *TwoFactorService) useTOTP(tx *gorm.DB, user *models.User, code string) error {
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+
+	result := tx.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func (s *TwoFactorService) replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		records = append(records, models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: utils.HashToken(utils.NormalizeRecoveryCode(code)),
+		})
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
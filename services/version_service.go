@@ -0,0 +1,102 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/NutsBalls/Nexus/models"
+
+	"gorm.io/gorm"
+)
+
+type VersionService struct {
+	db             *gorm.DB
+	coalesceWindow time.Duration
+}
+
+func NewVersionService(db *gorm.DB, coalesceWindow time.Duration) *VersionService {
+	return &VersionService{db: db, coalesceWindow: coalesceWindow}
+}
+
+// Snapshot сохраняет состояние документа до правки (previous) как новую версию.
+// Должен вызываться в той же транзакции, что и сохранение документа.
+func (vs *VersionService) Snapshot(tx *gorm.DB, previous models.Document, current models.Document, userID uint) error {
+	if previous.Title == current.Title && previous.Content == current.Content {
+		return nil
+	}
+
+	var last models.Version
+	err := tx.Where("document_id = ?", previous.ID).Order("created_at desc").First(&last).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	// Серия быстрых правок одного пользователя: версия с состоянием до
+	// начала серии уже есть, обновляем только описание изменений. Окно
+	// отсчитывается от создания версии, чтобы серия не тянулась бесконечно.
+	if err == nil && vs.coalesceWindow > 0 && last.Automatic && last.UserID == userID && time.Since(last.CreatedAt) < vs.coalesceWindow {
+		return tx.Model(&last).Updates(map[string]interface{}{
+			"change_log": BuildChangeLog(last.Title, last.Content, current.Title, current.Content),
+			"updated_at": time.Now(),
+		}).Error
+	}
+
+	version := models.Version{
+		DocumentID: previous.ID,
+		UserID:     userID,
+		Title:      previous.Title,
+		Content:    previous.Content,
+		ChangeLog:  BuildChangeLog(previous.Title, previous.Content, current.Title, current.Content),
+		Automatic:  true,
+	}
+	return tx.Create(&version).Error
+}
+
+// Record всегда создаёт отдельную версию с состоянием previous, без объединения
+// с предыдущими правками.
+func (vs *VersionService) Record(tx *gorm.DB, previous models.Document, userID uint, changeLog string) error {
+	version := models.Version{
+		DocumentID: previous.ID,
+		UserID:     userID,
+		Title:      previous.Title,
+		Content:    previous.Content,
+		ChangeLog:  changeLog,
+	}
+	return tx.Create(&version).Error
+}
+
+func BuildChangeLog(oldTitle, oldContent, newTitle, newContent string) string {
+	var changes []string
+
+	if oldTitle != newTitle {
+		changes = append(changes, fmt.Sprintf("title: %q -> %q", oldTitle, newTitle))
+	}
+
+	if oldContent != newContent {
+		oldLen := utf8.RuneCountInString(oldContent)
+		newLen := utf8.RuneCountInString(newContent)
+		changes = append(changes, fmt.Sprintf("content: %d -> %d characters", oldLen, newLen))
+	}
+
+	if len(changes) == 0 {
+		return "no changes"
+	}
+	return strings.Join(changes, "; ")
+}
+
+// Restore возвращает документ к содержимому версии. Текущее состояние
+// сохраняется отдельной версией, чтобы откат тоже можно было отменить.
+// document должен быть прочитан в транзакции tx с блокировкой строки.
+func (vs *VersionService) Restore(tx *gorm.DB, document *models.Document, version models.Version, userID uint) error {
+	if err := vs.Record(tx, *document, userID, fmt.Sprintf("restored version %d", version.ID)); err != nil {
+		return err
+	}
+
+	document.Title = version.Title
+	document.Content = version.Content
+	document.Revision++
+	return tx.Model(document).Select("title", "content", "revision", "updated_at").Updates(document).Error
+}
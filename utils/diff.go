@@ -0,0 +1,337 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type DiffOp string
+
+const (
+	DiffEqual  DiffOp = "equal"
+	DiffInsert DiffOp = "insert"
+	DiffDelete DiffOp = "delete"
+)
+
+type DiffHunk struct {
+	Op   DiffOp `json:"op"`
+	Text string `json:"text"`
+}
+
+type diffEdit struct {
+	op   DiffOp
+	text string
+}
+
+func DiffLines(a, b string) []DiffHunk {
+	return mergeEdits(diffTokens(SplitLines(a), SplitLines(b)))
+}
+
+func DiffWords(a, b string) []DiffHunk {
+	return mergeEdits(diffTokens(SplitWords(a), SplitWords(b)))
+}
+
+// Посимвольно уточняются только небольшие заменённые фрагменты: время
+// алгоритма Майерса растёт как произведение длины на число правок.
+const maxRefineRunes = 1000
+
+// DiffChars работает как DiffWords, но заменённые слова дополнительно
+// сравнивает посимвольно.
+func DiffChars(a, b string) []DiffHunk {
+	hunks := DiffWords(a, b)
+
+	var edits []diffEdit
+	for i := 0; i < len(hunks); i++ {
+		h := hunks[i]
+		if h.Op != DiffEqual && i+1 < len(hunks) && hunks[i+1].Op != DiffEqual {
+			deleted, inserted := h.Text, hunks[i+1].Text
+			if h.Op == DiffInsert {
+				deleted, inserted = inserted, deleted
+			}
+			if utf8.RuneCountInString(deleted)+utf8.RuneCountInString(inserted) <= maxRefineRunes {
+				edits = append(edits, diffTokens(splitRunes(deleted), splitRunes(inserted))...)
+				i++
+				continue
+			}
+		}
+		edits = append(edits, diffEdit{h.Op, h.Text})
+	}
+	return mergeEdits(edits)
+}
+
+func splitRunes(s string) []string {
+	runes := make([]string, 0, len(s))
+	for _, r := range s {
+		runes = append(runes, string(r))
+	}
+	return runes
+}
+
+// SplitLines режет текст на строки, сохраняя перевод строки в конце каждой,
+// так что склейка результата даёт исходный текст.
+func SplitLines(s string) []string {
+	var lines []string
+	for s != "" {
+		i := strings.IndexByte(s, '\n')
+		if i < 0 {
+			lines = append(lines, s)
+			break
+		}
+		lines = append(lines, s[:i+1])
+		s = s[i+1:]
+	}
+	return lines
+}
+
+// SplitWords режет текст на слова, серии пробельных символов и отдельные
+// знаки препинания.
+func SplitWords(s string) []string {
+	var tokens []string
+	for s != "" {
+		r, size := utf8.DecodeRuneInString(s)
+		end := size
+		switch {
+		case unicode.IsSpace(r):
+			end = scanWhile(s, end, unicode.IsSpace)
+		case isWordRune(r):
+			end = scanWhile(s, end, isWordRune)
+		}
+		tokens = append(tokens, s[:end])
+		s = s[end:]
+	}
+	return tokens
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+func scanWhile(s string, start int, pred func(rune) bool) int {
+	for start < len(s) {
+		r, size := utf8.DecodeRuneInString(s[start:])
+		if !pred(r) {
+			break
+		}
+		start += size
+	}
+	return start
+}
+
+func diffTokens(a, b []string) []diffEdit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits := make([]diffEdit, 0, len(a)+len(b))
+	for _, t := range a[:prefix] {
+		edits = append(edits, diffEdit{DiffEqual, t})
+	}
+	edits = append(edits, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, t := range a[len(a)-suffix:] {
+		edits = append(edits, diffEdit{DiffEqual, t})
+	}
+	return edits
+}
+
+// Сколько ячеек диагоналей алгоритм Майерса может сохранить для
+// восстановления пути. На шаге d хранится 2d+1 ячеек, так что память
+// растёт как D² и этот предел (около 32 МБ) допускает порядка двух тысяч
+// правок. Если правок больше, весь изменённый фрагмент считается заменённым.
+const maxDiffCells = 4 << 20
+
+// myers реализует алгоритм Майерса O((N+M)D) с восстановлением пути по
+// сохранённым диагоналям.
+func myers(a, b []string) []diffEdit {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+
+	offset := max
+	v := make([]int, 2*max+2)
+	// trace[d][k+d] — значение v[k] перед шагом d, для k от -d до d.
+	var trace [][]int
+	cells := 0
+
+search:
+	for d := 0; d <= max; d++ {
+		cells += 2*d + 1
+		if cells > maxDiffCells {
+			return replaceAll(a, b)
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1+offset] < v[k+1+offset]) {
+				x = v[k+1+offset]
+			} else {
+				x = v[k-1+offset] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k+offset] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var reversed []diffEdit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[k-1+d] < v[k+1+d]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := 0
+		if d > 0 {
+			prevX = v[prevK+d]
+		}
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, diffEdit{DiffEqual, a[x-1]})
+			x--
+			y--
+		}
+
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, diffEdit{DiffInsert, b[y-1]})
+			} else {
+				reversed = append(reversed, diffEdit{DiffDelete, a[x-1]})
+			}
+			x, y = prevX, prevY
+		}
+	}
+
+	edits := make([]diffEdit, len(reversed))
+	for i, e := range reversed {
+		edits[len(reversed)-1-i] = e
+	}
+	return edits
+}
+
+func replaceAll(a, b []string) []diffEdit {
+	edits := make([]diffEdit, 0, len(a)+len(b))
+	for _, t := range a {
+		edits = append(edits, diffEdit{DiffDelete, t})
+	}
+	for _, t := range b {
+		edits = append(edits, diffEdit{DiffInsert, t})
+	}
+	return edits
+}
+
+func mergeEdits(edits []diffEdit) []DiffHunk {
+	hunks := []DiffHunk{}
+	// Текст собирается через Builder: конкатенация строк в цикле квадратична.
+	var sb strings.Builder
+	for i, e := range edits {
+		sb.WriteString(e.text)
+		if i+1 < len(edits) && edits[i+1].op == e.op {
+			continue
+		}
+		hunks = append(hunks, DiffHunk{Op: e.op, Text: sb.String()})
+		sb.Reset()
+	}
+	return hunks
+}
+
+// UnifiedDiff строит построчный diff в формате `diff -u` с тремя строками контекста.
+func UnifiedDiff(fromLabel, toLabel, a, b string) string {
+	const context = 3
+
+	edits := diffTokens(SplitLines(a), SplitLines(b))
+
+	var changed []int
+	for i, e := range edits {
+		if e.op != DiffEqual {
+			changed = append(changed, i)
+		}
+	}
+	if len(changed) == 0 {
+		return ""
+	}
+
+	// Позиции каждой правки в старом и новом тексте.
+	oldPos := make([]int, len(edits)+1)
+	newPos := make([]int, len(edits)+1)
+	for i, e := range edits {
+		oldPos[i+1], newPos[i+1] = oldPos[i], newPos[i]
+		if e.op != DiffInsert {
+			oldPos[i+1]++
+		}
+		if e.op != DiffDelete {
+			newPos[i+1]++
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromLabel, toLabel)
+
+	for i := 0; i < len(changed); {
+		j := i
+		for j+1 < len(changed) && changed[j+1]-changed[j] <= 2*context {
+			j++
+		}
+
+		start := changed[i] - context
+		if start < 0 {
+			start = 0
+		}
+		end := changed[j] + context + 1
+		if end > len(edits) {
+			end = len(edits)
+		}
+
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n",
+			hunkRange(oldPos[start], oldPos[end]-oldPos[start]),
+			hunkRange(newPos[start], newPos[end]-newPos[start]))
+
+		for _, e := range edits[start:end] {
+			prefix := " "
+			switch e.op {
+			case DiffDelete:
+				prefix = "-"
+			case DiffInsert:
+				prefix = "+"
+			}
+			sb.WriteString(prefix)
+			sb.WriteString(e.text)
+			if !strings.HasSuffix(e.text, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		i = j + 1
+	}
+
+	return sb.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// sides восстанавливает исходный и новый текст из правок.
+func sides(hunks []DiffHunk) (string, string) {
+	var from, to strings.Builder
+	for _, h := range hunks {
+		if h.Op != DiffInsert {
+			from.WriteString(h.Text)
+		}
+		if h.Op != DiffDelete {
+			to.WriteString(h.Text)
+		}
+	}
+	return from.String(), to.String()
+}
+
+func TestDiffRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"empty", "", ""},
+		{"insert into empty", "", "hello\n"},
+		{"delete everything", "hello\nworld\n", ""},
+		{"equal", "one\ntwo\n", "one\ntwo\n"},
+		{"change middle line", "one\ntwo\nthree\n", "one\n2\nthree\n"},
+		{"no trailing newline", "one\ntwo", "one\ntwo\nthree"},
+		{"reorder", "a\nb\nc\nd\n", "d\nc\nb\na\n"},
+		{"unicode", "привет, мир\n", "привет, новый мир 🌍\n"},
+	}
+
+	diffs := map[string]func(a, b string) []DiffHunk{
+		"lines": DiffLines,
+		"words": DiffWords,
+		"chars": DiffChars,
+	}
+
+	for _, tt := range tests {
+		for name, diff := range diffs {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				from, to := sides(diff(tt.a, tt.b))
+				if from != tt.a || to != tt.b {
+					t.Fatalf("round trip = (%q, %q), want (%q, %q)", from, to, tt.a, tt.b)
+				}
+			})
+		}
+	}
+}
+
+func TestMyersMinimalEdits(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		edits int
+	}{
+		{"abcabba", "cbabac", 5},
+		{"abc", "abc", 0},
+		{"abc", "", 3},
+		{"", "xyz", 3},
+		{"kitten", "sitting", 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"->"+tt.b, func(t *testing.T) {
+			edits := myers(splitRunes(tt.a), splitRunes(tt.b))
+			changed := 0
+			for _, e := range edits {
+				if e.op != DiffEqual {
+					changed++
+				}
+			}
+			if changed != tt.edits {
+				t.Fatalf("myers made %d edits, want %d", changed, tt.edits)
+			}
+		})
+	}
+}
+
+func TestMyersFallsBackPastCellLimit(t *testing.T) {
+	// Каждый второй токен общий, поэтому оптимальный diff их сохранил бы.
+	// Но правок D = n, и около d = 2048 хранимые диагонали превышают
+	// maxDiffCells, так что весь фрагмент заменяется целиком.
+	const n = 6000
+	a := make([]string, n)
+	b := make([]string, n)
+	for i := range a {
+		if i%2 == 0 {
+			a[i] = fmt.Sprintf("s%d\n", i)
+			b[i] = a[i]
+			continue
+		}
+		a[i] = fmt.Sprintf("a%d\n", i)
+		b[i] = fmt.Sprintf("b%d\n", i)
+	}
+
+	edits := myers(a, b)
+	want := replaceAll(a, b)
+	if len(edits) != len(want) {
+		t.Fatalf("got %d edits, want %d", len(edits), len(want))
+	}
+	for i := range want {
+		if edits[i] != want[i] {
+			t.Fatalf("edit %d = %+v, want %+v", i, edits[i], want[i])
+		}
+	}
+
+	from, to := sides(mergeEdits(edits))
+	if from != strings.Join(a, "") || to != strings.Join(b, "") {
+		t.Fatal("fallback does not reproduce both texts")
+	}
+}
@@ -14,25 +14,29 @@ type JWTCustomClaims struct {
 	jwt.StandardClaims
 }
 
-func CreateJWTToken(id uint, username string, email string, secret []byte, expirationTime int64) (string, error) {
+func CreateJWTToken(id uint, username string, email string, keys *KeySet, expirationTime int64) (string, error) {
+	// jti позволяет отозвать конкретный токен до истечения срока.
+	jti, err := RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
 	claims := &JWTCustomClaims{
 		ID:       id,
 		Username: username,
 		Email:    email,
 		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
 			ExpiresAt: expirationTime,
 			IssuedAt:  time.Now().Unix(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(secret)
+	return keys.Sign(claims)
 }
 
-func ValidateJWTToken(tokenString string, secret []byte) (*JWTCustomClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &JWTCustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return secret, nil
-	})
+func ValidateJWTToken(tokenString string, keys *KeySet) (*JWTCustomClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &JWTCustomClaims{}, keys.Keyfunc)
 
 	if err != nil {
 		return nil, err
@@ -49,10 +53,9 @@ func IsTokenExpired(claims *JWTCustomClaims) bool {
 	return time.Now().Unix() > claims.ExpiresAt
 }
 
-func RefreshJWTToken(oldToken *jwt.Token, secret []byte, newExpirationTime int64) (string, error) {
+func RefreshJWTToken(oldToken *jwt.Token, keys *KeySet, newExpirationTime int64) (string, error) {
 	claims := oldToken.Claims.(*JWTCustomClaims)
 	claims.ExpiresAt = newExpirationTime
 
-	newToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return newToken.SignedString(secret)
+	return keys.Sign(claims)
 }
@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const minRSAKeyBits = 2048
+
+// SigningKey — ключ подписи JWT. Ключи предыдущих поколений хранят только
+// открытую часть и принимаются до NotAfter.
+type SigningKey struct {
+	ID       string
+	Method   jwt.SigningMethod
+	private  interface{}
+	public   interface{}
+	NotAfter time.Time
+}
+
+// KeySet подписывает токены активным ключом и проверяет их любым из
+// действующих ключей по заголовку kid.
+type KeySet struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// NewHMACKeySet возвращает набор из одного симметричного ключа HS256.
+// Такие токены нельзя проверить снаружи, поэтому JWKS для них пуст.
+func NewHMACKeySet(secret []byte) *KeySet {
+	key := &SigningKey{ID: "hs256", Method: jwt.SigningMethodHS256, private: secret, public: secret}
+	return &KeySet{active: key, keys: map[string]*SigningKey{key.ID: key}}
+}
+
+// LoadKeySet читает активный закрытый ключ RS256 или EdDSA из PEM-файла
+// activePath и ключи предыдущих поколений из previousPaths. Предыдущие ключи
+// принимаются для проверки до previousUntil.
+func LoadKeySet(activePath string, previousPaths []string, previousUntil time.Time) (*KeySet, error) {
+	active, err := loadSigningKey(activePath)
+	if err != nil {
+		return nil, err
+	}
+	if active.private == nil {
+		return nil, fmt.Errorf("%s: signing key must be a private key", activePath)
+	}
+
+	set := &KeySet{active: active, keys: map[string]*SigningKey{active.ID: active}}
+	for _, path := range previousPaths {
+		key, err := loadSigningKey(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := set.keys[key.ID]; ok {
+			continue
+		}
+		// Старым ключом больше не подписываем.
+		key.private = nil
+		key.NotAfter = previousUntil
+		set.keys[key.ID] = key
+	}
+	return set, nil
+}
+
+func loadSigningKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{}
+	if private, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+		key.Method, key.private, key.public = jwt.SigningMethodRS256, private, &private.PublicKey
+	} else if private, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+		edKey := private.(ed25519.PrivateKey)
+		key.Method, key.private, key.public = jwt.SigningMethodEdDSA, edKey, edKey.Public()
+	} else if public, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		key.Method, key.public = jwt.SigningMethodRS256, public
+	} else if public, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+		key.Method, key.public = jwt.SigningMethodEdDSA, public.(ed25519.PublicKey)
+	} else {
+		return nil, fmt.Errorf("%s: expected an RSA or Ed25519 key in PEM format", path)
+	}
+
+	if public, ok := key.public.(*rsa.PublicKey); ok && public.N.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("%s: RSA key must be at least %d bits", path, minRSAKeyBits)
+	}
+
+	// kid выводится из открытого ключа, поэтому не зависит от имени файла.
+	der, err := x509.MarshalPKIXPublicKey(key.public)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+	key.ID = base64.RawURLEncoding.EncodeToString(sum[:12])
+	return key, nil
+}
+
+// Sign подписывает claims активным ключом.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	token.Header["kid"] = ks.active.ID
+	return token.SignedString(ks.active.private)
+}
+
+// Keyfunc выбирает ключ проверки по kid для jwt.Parse. Алгоритм токена
+// должен совпадать с алгоритмом ключа.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	key := ks.active
+	if kid, ok := token.Header["kid"].(string); ok {
+		key, ok = ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+	} else if key.Method != jwt.SigningMethodHS256 {
+		// Без kid принимаются только токены, подписанные общим секретом.
+		return nil, fmt.Errorf("token has no key id")
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	if !key.NotAfter.IsZero() && time.Now().After(key.NotAfter) {
+		return nil, fmt.Errorf("key %q has been retired", key.ID)
+	}
+	return key.public, nil
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS возвращает открытые ключи, которыми сейчас можно проверить токены.
+func (ks *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	now := time.Now()
+	for _, key := range ks.keys {
+		if !key.NotAfter.IsZero() && now.After(key.NotAfter) {
+			continue
+		}
+
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
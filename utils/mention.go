@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Упоминание начинается с @ в начале текста или после символа, который не
+// может быть частью имени, поэтому адреса вида john@example.com не совпадают.
+// Имена могут содержать буквы и цифры любого алфавита, а не только ASCII.
+var mentionPattern = regexp.MustCompile(`(^|[^\p{L}\p{N}_@])@([\p{L}\p{N}_][\p{L}\p{N}_.-]*)`)
+
+type Mention struct {
+	Username string
+	// Позиция символа @ в кодовых единицах UTF-16.
+	Offset int
+}
+
+func ParseMentions(text string) []Mention {
+	var mentions []Mention
+	for _, m := range mentionPattern.FindAllStringSubmatchIndex(text, -1) {
+		at := m[4] - 1
+		username := strings.TrimRight(text[m[4]:m[5]], ".-")
+		if username == "" {
+			continue
+		}
+		mentions = append(mentions, Mention{
+			Username: username,
+			Offset:   UTF16Len(text[:at]),
+		})
+	}
+	return mentions
+}
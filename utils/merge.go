@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"strings"
+)
+
+type MergeConflict struct {
+	// Номера строк (с 1) в результате слияния, включая маркеры конфликта.
+	StartLine int `json:"start_line"`
+	EndLine   int `json:"end_line"`
+	// Диапазон строк базовой версии [BaseStart, BaseEnd), нумерация с 1.
+	BaseStart int    `json:"base_start"`
+	BaseEnd   int    `json:"base_end"`
+	Base      string `json:"base"`
+	Ours      string `json:"ours"`
+	Theirs    string `json:"theirs"`
+}
+
+type MergeResult struct {
+	Content   string          `json:"content"`
+	Clean     bool            `json:"clean"`
+	Conflicts []MergeConflict `json:"conflicts"`
+}
+
+// lineChange описывает замену строк base[start:end] на lines.
+type lineChange struct {
+	start, end int
+	lines      []string
+}
+
+// Merge3 выполняет построчное трёхстороннее слияние. Изменения, которые
+// пересекаются или соприкасаются в базовой версии и не совпадают, попадают
+// в результат с маркерами конфликта.
+func Merge3(base, ours, theirs, oursLabel, theirsLabel string) MergeResult {
+	baseLines := SplitLines(base)
+	oursChanges := lineChanges(diffTokens(baseLines, SplitLines(ours)))
+	theirsChanges := lineChanges(diffTokens(baseLines, SplitLines(theirs)))
+
+	result := MergeResult{Clean: true, Conflicts: []MergeConflict{}}
+	var merged []string
+	pos := 0
+	i, j := 0, 0
+
+	for i < len(oursChanges) || j < len(theirsChanges) {
+		var start, end int
+		if j >= len(theirsChanges) || (i < len(oursChanges) && oursChanges[i].start <= theirsChanges[j].start) {
+			start, end = oursChanges[i].start, oursChanges[i].end
+		} else {
+			start, end = theirsChanges[j].start, theirsChanges[j].end
+		}
+
+		var oursIn, theirsIn []lineChange
+		for grew := true; grew; {
+			grew = false
+			for i < len(oursChanges) && oursChanges[i].start <= end {
+				oursIn = append(oursIn, oursChanges[i])
+				end = max(end, oursChanges[i].end)
+				i++
+				grew = true
+			}
+			for j < len(theirsChanges) && theirsChanges[j].start <= end {
+				theirsIn = append(theirsIn, theirsChanges[j])
+				end = max(end, theirsChanges[j].end)
+				j++
+				grew = true
+			}
+		}
+
+		merged = append(merged, baseLines[pos:start]...)
+		pos = end
+
+		oursRegion := applyLineChanges(baseLines, start, end, oursIn)
+		theirsRegion := applyLineChanges(baseLines, start, end, theirsIn)
+
+		switch {
+		case len(oursIn) == 0:
+			merged = append(merged, theirsRegion...)
+		case len(theirsIn) == 0 || equalLines(oursRegion, theirsRegion):
+			merged = append(merged, oursRegion...)
+		default:
+			result.Clean = false
+			conflict := MergeConflict{
+				StartLine: len(merged) + 1,
+				BaseStart: start + 1,
+				BaseEnd:   end + 1,
+				Base:      strings.Join(baseLines[start:end], ""),
+				Ours:      strings.Join(oursRegion, ""),
+				Theirs:    strings.Join(theirsRegion, ""),
+			}
+			merged = append(merged, "<<<<<<< "+oursLabel+"\n")
+			merged = append(merged, terminateLines(oursRegion)...)
+			merged = append(merged, "=======\n")
+			merged = append(merged, terminateLines(theirsRegion)...)
+			merged = append(merged, ">>>>>>> "+theirsLabel+"\n")
+			conflict.EndLine = len(merged)
+			result.Conflicts = append(result.Conflicts, conflict)
+		}
+	}
+	merged = append(merged, baseLines[pos:]...)
+
+	result.Content = strings.Join(merged, "")
+	return result
+}
+
+func lineChanges(edits []diffEdit) []lineChange {
+	var changes []lineChange
+	var current *lineChange
+	pos := 0
+
+	for _, e := range edits {
+		if e.op == DiffEqual {
+			if current != nil {
+				changes = append(changes, *current)
+				current = nil
+			}
+			pos++
+			continue
+		}
+
+		if current == nil {
+			current = &lineChange{start: pos, end: pos}
+		}
+		if e.op == DiffDelete {
+			pos++
+			current.end = pos
+		} else {
+			current.lines = append(current.lines, e.text)
+		}
+	}
+	if current != nil {
+		changes = append(changes, *current)
+	}
+	return changes
+}
+
+func applyLineChanges(base []string, start, end int, changes []lineChange) []string {
+	var lines []string
+	pos := start
+	for _, c := range changes {
+		lines = append(lines, base[pos:c.start]...)
+		lines = append(lines, c.lines...)
+		pos = c.end
+	}
+	return append(lines, base[pos:end]...)
+}
+
+// terminateLines гарантирует перевод строки после последней строки,
+// чтобы маркер конфликта начинался с новой строки.
+func terminateLines(lines []string) []string {
+	if n := len(lines); n > 0 && !strings.HasSuffix(lines[n-1], "\n") {
+		terminated := append([]string(nil), lines...)
+		terminated[n-1] += "\n"
+		return terminated
+	}
+	return lines
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
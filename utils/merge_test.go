@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	const base = "one\ntwo\nthree\nfour\nfive\n"
+
+	tests := []struct {
+		name      string
+		ours      string
+		theirs    string
+		content   string
+		conflicts []MergeConflict
+	}{
+		{
+			name:    "only ours changed",
+			ours:    "one\nTWO\nthree\nfour\nfive\n",
+			theirs:  base,
+			content: "one\nTWO\nthree\nfour\nfive\n",
+		},
+		{
+			name:    "only theirs changed",
+			ours:    base,
+			theirs:  "one\ntwo\nthree\nfour\nfive\nsix\n",
+			content: "one\ntwo\nthree\nfour\nfive\nsix\n",
+		},
+		{
+			name:    "separate lines",
+			ours:    "one\nTWO\nthree\nfour\nfive\n",
+			theirs:  "one\ntwo\nthree\nFOUR\nfive\n",
+			content: "one\nTWO\nthree\nFOUR\nfive\n",
+		},
+		{
+			name:    "same change on both sides",
+			ours:    "one\ntwo\nTHREE\nfour\nfive\n",
+			theirs:  "one\ntwo\nTHREE\nfour\nfive\n",
+			content: "one\ntwo\nTHREE\nfour\nfive\n",
+		},
+		{
+			name:    "same line changed differently",
+			ours:    "one\ntwo\nours\nfour\nfive\n",
+			theirs:  "one\ntwo\ntheirs\nfour\nfive\n",
+			content: "one\ntwo\n<<<<<<< mine\nours\n=======\ntheirs\n>>>>>>> server\nfour\nfive\n",
+			conflicts: []MergeConflict{{
+				StartLine: 3, EndLine: 7,
+				BaseStart: 3, BaseEnd: 4,
+				Base: "three\n", Ours: "ours\n", Theirs: "theirs\n",
+			}},
+		},
+		{
+			name:    "adjacent lines conflict",
+			ours:    "one\nTWO\nthree\nfour\nfive\n",
+			theirs:  "one\ntwo\nTHREE\nfour\nfive\n",
+			content: "one\n<<<<<<< mine\nTWO\nthree\n=======\ntwo\nTHREE\n>>>>>>> server\nfour\nfive\n",
+			conflicts: []MergeConflict{{
+				StartLine: 2, EndLine: 8,
+				BaseStart: 2, BaseEnd: 4,
+				Base: "two\nthree\n", Ours: "TWO\nthree\n", Theirs: "two\nTHREE\n",
+			}},
+		},
+		{
+			name:    "delete against edit",
+			ours:    "one\ntwo\nfour\nfive\n",
+			theirs:  "one\ntwo\nTHREE\nfour\nfive\n",
+			content: "one\ntwo\n<<<<<<< mine\n=======\nTHREE\n>>>>>>> server\nfour\nfive\n",
+			conflicts: []MergeConflict{{
+				StartLine: 3, EndLine: 6,
+				BaseStart: 3, BaseEnd: 4,
+				Base: "three\n", Ours: "", Theirs: "THREE\n",
+			}},
+		},
+		{
+			name:    "missing final newline inside conflict",
+			ours:    "one\ntwo\nthree\nfour\nours",
+			theirs:  "one\ntwo\nthree\nfour\ntheirs",
+			content: "one\ntwo\nthree\nfour\n<<<<<<< mine\nours\n=======\ntheirs\n>>>>>>> server\n",
+			conflicts: []MergeConflict{{
+				StartLine: 5, EndLine: 9,
+				BaseStart: 5, BaseEnd: 6,
+				Base: "five\n", Ours: "ours", Theirs: "theirs",
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Merge3(base, tt.ours, tt.theirs, "mine", "server")
+
+			if result.Content != tt.content {
+				t.Errorf("content = %q, want %q", result.Content, tt.content)
+			}
+			if result.Clean != (len(tt.conflicts) == 0) {
+				t.Errorf("clean = %v, want %v", result.Clean, len(tt.conflicts) == 0)
+			}
+			if len(result.Conflicts) != len(tt.conflicts) {
+				t.Fatalf("got %d conflicts, want %d: %+v", len(result.Conflicts), len(tt.conflicts), result.Conflicts)
+			}
+			for i, want := range tt.conflicts {
+				if result.Conflicts[i] != want {
+					t.Errorf("conflict %d = %+v, want %+v", i, result.Conflicts[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// OpComponent — один шаг текстовой операции: пропустить Retain символов,
+// вставить Insert или удалить Delete символов. Длины считаются в кодовых
+// единицах UTF-16, как в JavaScript и Dart клиентах.
+type OpComponent struct {
+	Retain int
+	Insert string
+	Delete int
+}
+
+func (c OpComponent) isRetain() bool { return c.Retain > 0 }
+func (c OpComponent) isInsert() bool { return c.Insert != "" }
+func (c OpComponent) isDelete() bool { return c.Delete > 0 }
+
+// TextOperation в JSON совместима с форматом ot.js:
+// положительное число — retain, отрицательное — delete, строка — insert.
+type TextOperation []OpComponent
+
+var ErrOperationMismatch = errors.New("operation length does not match document")
+
+// maxOperationLength ограничивает длину документа до и после операции при
+// разборе JSON, чтобы суммы длин не переполнялись.
+const maxOperationLength = 64 << 20
+
+func (op TextOperation) MarshalJSON() ([]byte, error) {
+	items := make([]interface{}, 0, len(op))
+	for _, c := range op {
+		switch {
+		case c.isRetain():
+			items = append(items, c.Retain)
+		case c.isDelete():
+			items = append(items, -c.Delete)
+		default:
+			items = append(items, c.Insert)
+		}
+	}
+	return json.Marshal(items)
+}
+
+func (op *TextOperation) UnmarshalJSON(data []byte) error {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+
+	var b opBuilder
+	base, target := 0, 0
+	for _, item := range items {
+		var text string
+		if err := json.Unmarshal(item, &text); err == nil {
+			target += UTF16Len(text)
+			if target > maxOperationLength {
+				return errors.New("operation is too long")
+			}
+			b.insert(text)
+			continue
+		}
+
+		var n int
+		if err := json.Unmarshal(item, &n); err != nil {
+			return fmt.Errorf("invalid operation component %s", item)
+		}
+		if n == 0 {
+			return errors.New("operation component cannot be zero")
+		}
+		// Проверка до сложения: -n переполняется для минимального int.
+		if n > maxOperationLength || n < -maxOperationLength {
+			return errors.New("operation is too long")
+		}
+		if n > 0 {
+			base += n
+			target += n
+			b.retain(n)
+		} else {
+			base -= n
+			b.delete(-n)
+		}
+		if base > maxOperationLength || target > maxOperationLength {
+			return errors.New("operation is too long")
+		}
+	}
+
+	*op = b.ops
+	return nil
+}
+
+// BaseLength — длина документа, к которому применима операция.
+func (op TextOperation) BaseLength() int {
+	n := 0
+	for _, c := range op {
+		n += c.Retain + c.Delete
+	}
+	return n
+}
+
+// TargetLength — длина документа после применения операции.
+func (op TextOperation) TargetLength() int {
+	n := 0
+	for _, c := range op {
+		n += c.Retain + UTF16Len(c.Insert)
+	}
+	return n
+}
+
+func (op TextOperation) IsNoop() bool {
+	for _, c := range op {
+		if !c.isRetain() {
+			return false
+		}
+	}
+	return true
+}
+
+func (op TextOperation) Apply(text string) (string, error) {
+	units := utf16.Encode([]rune(text))
+	if op.BaseLength() != len(units) {
+		return "", ErrOperationMismatch
+	}
+
+	result := make([]uint16, 0, len(units))
+	pos := 0
+	for _, c := range op {
+		// Шаги проверяются по отдельности: сумма в BaseLength могла переполниться.
+		if c.Retain < 0 || c.Delete < 0 || c.Retain > len(units)-pos || c.Delete > len(units)-pos {
+			return "", ErrOperationMismatch
+		}
+		switch {
+		case c.isRetain():
+			result = append(result, units[pos:pos+c.Retain]...)
+			pos += c.Retain
+		case c.isDelete():
+			pos += c.Delete
+		default:
+			result = append(result, utf16.Encode([]rune(c.Insert))...)
+		}
+	}
+	if pos != len(units) {
+		return "", ErrOperationMismatch
+	}
+	return string(utf16.Decode(result)), nil
+}
+
+// TransformIndex переносит позицию курсора в документе через операцию.
+// Текст, вставленный ровно в позицию курсора, оказывается перед ним.
+func (op TextOperation) TransformIndex(index int) int {
+	return op.transformIndex(index, true)
+}
+
+// TransformRange переносит диапазон [start, end) через операцию так, чтобы
+// текст, вставленный на его границах, не попадал внутрь.
+func (op TextOperation) TransformRange(start, end int) (int, int) {
+	newStart := op.transformIndex(start, true)
+	newEnd := op.transformIndex(end, false)
+	return newStart, max(newStart, newEnd)
+}
+
+func (op TextOperation) transformIndex(index int, insertBefore bool) int {
+	newIndex := index
+	for _, c := range op {
+		if index == 0 && !insertBefore {
+			break
+		}
+		switch {
+		case c.isRetain():
+			index -= c.Retain
+		case c.isInsert():
+			newIndex += UTF16Len(c.Insert)
+		default:
+			newIndex -= min(index, c.Delete)
+			index -= c.Delete
+		}
+		if index < 0 {
+			break
+		}
+	}
+	return newIndex
+}
+
+// SliceUTF16 возвращает часть строки между смещениями в кодовых единицах UTF-16.
+func SliceUTF16(s string, start, end int) string {
+	units := utf16.Encode([]rune(s))
+	start = max(0, min(start, len(units)))
+	end = max(start, min(end, len(units)))
+	return string(utf16.Decode(units[start:end]))
+}
+
+// TransformOperations для операций a и b над одним документом возвращает a' и b',
+// такие что apply(apply(S, a), b') == apply(apply(S, b), a'). При вставке
+// в одну позицию текст a оказывается первым.
+func TransformOperations(a, b TextOperation) (TextOperation, TextOperation, error) {
+	if a.BaseLength() != b.BaseLength() {
+		return nil, nil, ErrOperationMismatch
+	}
+
+	var a1, b1 opBuilder
+	i, j := 0, 0
+	var op1, op2 *OpComponent
+	next := func(op TextOperation, idx *int) *OpComponent {
+		if *idx >= len(op) {
+			return nil
+		}
+		c := op[*idx]
+		*idx++
+		return &c
+	}
+	op1, op2 = next(a, &i), next(b, &j)
+
+	for op1 != nil || op2 != nil {
+		if op1 != nil && op1.isInsert() {
+			a1.insert(op1.Insert)
+			b1.retain(UTF16Len(op1.Insert))
+			op1 = next(a, &i)
+			continue
+		}
+		if op2 != nil && op2.isInsert() {
+			a1.retain(UTF16Len(op2.Insert))
+			b1.insert(op2.Insert)
+			op2 = next(b, &j)
+			continue
+		}
+		if op1 == nil || op2 == nil {
+			return nil, nil, ErrOperationMismatch
+		}
+
+		n1, n2 := op1.Retain+op1.Delete, op2.Retain+op2.Delete
+		n := min(n1, n2)
+
+		switch {
+		case op1.isRetain() && op2.isRetain():
+			a1.retain(n)
+			b1.retain(n)
+		case op1.isDelete() && op2.isRetain():
+			a1.delete(n)
+		case op1.isRetain() && op2.isDelete():
+			b1.delete(n)
+		}
+		// delete/delete: оба уже удалили этот участок, ничего не добавляем.
+
+		if n1 == n {
+			op1 = next(a, &i)
+		} else {
+			op1.Retain, op1.Delete = shrink(op1.Retain, n), shrink(op1.Delete, n)
+		}
+		if n2 == n {
+			op2 = next(b, &j)
+		} else {
+			op2.Retain, op2.Delete = shrink(op2.Retain, n), shrink(op2.Delete, n)
+		}
+	}
+
+	return a1.ops, b1.ops, nil
+}
+
+func shrink(v, n int) int {
+	if v == 0 {
+		return 0
+	}
+	return v - n
+}
+
+// DiffOperation строит операцию, превращающую from в to.
+func DiffOperation(from, to string) TextOperation {
+	var b opBuilder
+	for _, h := range DiffChars(from, to) {
+		switch h.Op {
+		case DiffEqual:
+			b.retain(UTF16Len(h.Text))
+		case DiffDelete:
+			b.delete(UTF16Len(h.Text))
+		case DiffInsert:
+			b.insert(h.Text)
+		}
+	}
+	return b.ops
+}
+
+func UTF16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// opBuilder собирает операцию в канонической форме: соседние шаги одного
+// типа склеиваются, вставка всегда идёт перед удалением.
+type opBuilder struct {
+	ops TextOperation
+}
+
+func (b *opBuilder) retain(n int) {
+	if n <= 0 {
+		return
+	}
+	if last := len(b.ops) - 1; last >= 0 && b.ops[last].isRetain() {
+		b.ops[last].Retain += n
+		return
+	}
+	b.ops = append(b.ops, OpComponent{Retain: n})
+}
+
+func (b *opBuilder) insert(s string) {
+	if s == "" {
+		return
+	}
+	last := len(b.ops) - 1
+	if last >= 0 && b.ops[last].isInsert() {
+		b.ops[last].Insert += s
+		return
+	}
+	if last >= 0 && b.ops[last].isDelete() {
+		if last > 0 && b.ops[last-1].isInsert() {
+			b.ops[last-1].Insert += s
+			return
+		}
+		b.ops = append(b.ops, b.ops[last])
+		b.ops[last] = OpComponent{Insert: s}
+		return
+	}
+	b.ops = append(b.ops, OpComponent{Insert: s})
+}
+
+func (b *opBuilder) delete(n int) {
+	if n <= 0 {
+		return
+	}
+	if last := len(b.ops) - 1; last >= 0 && b.ops[last].isDelete() {
+		b.ops[last].Delete += n
+		return
+	}
+	b.ops = append(b.ops, OpComponent{Delete: n})
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestTransformOperationsConverge(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		a, b string
+		want string
+	}{
+		{"inserts at same position", "abc", "abXc", "abYc", "abXYc"},
+		{"inserts at different positions", "hello world", "hello, world", "hello world!", "hello, world!"},
+		{"insert inside deleted range", "abcdef", "abXcdef", "af", "aXf"},
+		{"overlapping deletes", "abcdef", "aef", "abf", "af"},
+		{"same delete", "abcdef", "abf", "abf", "abf"},
+		{"delete everything against insert", "abc", "", "abcd", "d"},
+		{"both into empty", "", "left", "right", "leftright"},
+		{"surrogate pairs", "😀 мир", "😀 новый мир", "😀😀 мир", "😀😀 новый мир"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := DiffOperation(tt.doc, tt.a), DiffOperation(tt.doc, tt.b)
+			a1, b1, err := TransformOperations(a, b)
+			if err != nil {
+				t.Fatalf("transform: %v", err)
+			}
+
+			left := mustApply(t, mustApply(t, tt.doc, a), b1)
+			right := mustApply(t, mustApply(t, tt.doc, b), a1)
+			if left != right {
+				t.Fatalf("diverged: a then b' = %q, b then a' = %q", left, right)
+			}
+			if left != tt.want {
+				t.Fatalf("result = %q, want %q", left, tt.want)
+			}
+		})
+	}
+}
+
+func mustApply(t *testing.T, text string, op TextOperation) string {
+	t.Helper()
+	result, err := op.Apply(text)
+	if err != nil {
+		t.Fatalf("apply %v to %q: %v", op, text, err)
+	}
+	return result
+}
+
+func TestTextOperationUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want TextOperation
+		err  bool
+	}{
+		{"ot.js format", `[2, "x", -1, 3]`, TextOperation{{Retain: 2}, {Insert: "x"}, {Delete: 1}, {Retain: 3}}, false},
+		{"merges neighbours", `[1, 1, -2, -1]`, TextOperation{{Retain: 2}, {Delete: 3}}, false},
+		{"zero", `[0]`, nil, true},
+		{"not a component", `[true]`, nil, true},
+		{"retain too long", `[67108865]`, nil, true},
+		{"min int delete", `[-9223372036854775808]`, nil, true},
+		{"sum too long", `[67108864, -1]`, nil, true},
+		{"int overflow", `[9223372036854775807, 9223372036854775807]`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var op TextOperation
+			err := json.Unmarshal([]byte(tt.json), &op)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("decoded %v, want error", op)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if len(op) != len(tt.want) {
+				t.Fatalf("op = %v, want %v", op, tt.want)
+			}
+			for i := range op {
+				if op[i] != tt.want[i] {
+					t.Fatalf("op = %v, want %v", op, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyRejectsMismatchedOperation(t *testing.T) {
+	const maxInt = int(^uint(0) >> 1)
+
+	tests := []struct {
+		name string
+		op   TextOperation
+	}{
+		{"too short", TextOperation{{Retain: 2}}},
+		{"too long", TextOperation{{Retain: 4}}},
+		{"delete past end", TextOperation{{Retain: 1}, {Delete: 3}}},
+		// Сумма переполняется и совпадает с длиной документа.
+		{"overflowing sum", TextOperation{{Retain: maxInt}, {Retain: maxInt}, {Retain: 5}}},
+		{"negative retain", TextOperation{{Retain: 5}, {Retain: -2}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.op.Apply("abc"); !errors.Is(err, ErrOperationMismatch) {
+				t.Fatalf("apply error = %v, want ErrOperationMismatch", err)
+			}
+		})
+	}
+}
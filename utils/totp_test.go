@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// Секрет "12345678901234567890" из приложения B RFC 6238 в base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// Последние шесть цифр восьмизначных кодов SHA1 из RFC 6238.
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/totpPeriod); got != tt.code {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	// Код 081804 выдан в 1111111109, на шаге 37037036,
+	// который заканчивается через секунду.
+	const issued = 1111111109
+	const step = issued / totpPeriod
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		unix   int64
+		ok     bool
+	}{
+		{"same step", rfc6238Secret, "081804", issued, true},
+		{"first second of next step", rfc6238Secret, "081804", issued + 1, true},
+		{"last second of next step", rfc6238Secret, "081804", issued + 30, true},
+		{"two steps later", rfc6238Secret, "081804", issued + 31, false},
+		{"previous step", rfc6238Secret, "081804", issued - 30, true},
+		{"two steps earlier", rfc6238Secret, "081804", issued - 60, false},
+		{"spaces are ignored", rfc6238Secret, "081 804", issued, true},
+		{"lower-case secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "081804", issued, true},
+		{"wrong code", rfc6238Secret, "081805", issued, false},
+		{"too short", rfc6238Secret, "81804", issued, false},
+		{"eight digits", rfc6238Secret, "07081804", issued, false},
+		{"invalid secret", "not base32!", "081804", issued, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ValidateTOTP(tt.secret, tt.code, time.Unix(tt.unix, 0))
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			// Возвращается шаг, на котором код был выдан, а не текущий.
+			if ok && got != step {
+				t.Fatalf("step = %d, want %d", got, step)
+			}
+		})
+	}
+}